@@ -20,11 +20,18 @@
 package lock
 
 import (
+	"fmt"
+	"io"
+	"time"
+
 	"v.io/v23"
 	"v.io/v23/context"
 	"v.io/v23/rpc"
 	"v.io/v23/security"
+	"v.io/v23/security/access"
+	"v.io/v23/uniqueid"
 	"v.io/v23/vdl"
+	vdltime "v.io/v23/vdlroot/time"
 )
 
 var _ = __VDLInit() // Must be first; see __VDLInit comments for details.
@@ -61,12 +68,1336 @@ func (x *LockStatus) VDLRead(dec vdl.Decoder) error {
 	return nil
 }
 
+// LockDiagnostics describes the state of a lock device, for troubleshooting it
+// remotely.
+type LockDiagnostics struct {
+	// Version is the version of the lockd binary running on the device.
+	Version string
+	// Uptime is the time elapsed since lockd was started.
+	Uptime time.Duration
+	// Hardware is the name of the hardware backend in use (e.g. "simulated" or "rpi").
+	Hardware string
+	// Pins maps the function of each GPIO pin used by the hardware (e.g. "relay")
+	// to the pin.
+	Pins map[string]string
+	// LastHardwareError is the error returned by the most recent failed attempt
+	// to lock or unlock, or empty if there has been none since lockd started.
+	LastHardwareError string
+	// LastHardwareErrorTime is the time at which LastHardwareError occurred.
+	LastHardwareErrorTime time.Time
+	// Actuations is the number of times the hardware has successfully changed
+	// the state of the lock since lockd started.
+	Actuations uint64
+	// ConfigDirBytes is the disk usage, in bytes, of lockd's configuration
+	// directory.
+	ConfigDirBytes uint64
+	// NeighborhoodName is the name under which the lock is visible in the
+	// local neighborhood.
+	NeighborhoodName string
+	// BatteryLevel is the remaining charge of the battery of the device, as a
+	// fraction of its capacity, or -1 if the device cannot sense its battery.
+	BatteryLevel float64
+}
+
+func (LockDiagnostics) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.LockDiagnostics"`
+}) {
+}
+
+func (x LockDiagnostics) VDLIsZero() bool {
+	if x.Version != "" {
+		return false
+	}
+	if x.Uptime != 0 {
+		return false
+	}
+	if x.Hardware != "" {
+		return false
+	}
+	if len(x.Pins) != 0 {
+		return false
+	}
+	if x.LastHardwareError != "" {
+		return false
+	}
+	if !x.LastHardwareErrorTime.IsZero() {
+		return false
+	}
+	if x.Actuations != 0 {
+		return false
+	}
+	if x.ConfigDirBytes != 0 {
+		return false
+	}
+	if x.NeighborhoodName != "" {
+		return false
+	}
+	if x.BatteryLevel != 0 {
+		return false
+	}
+	return true
+}
+
+func (x LockDiagnostics) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_2); err != nil {
+		return err
+	}
+	if x.Version != "" {
+		if err := enc.NextFieldValueString(0, vdl.StringType, x.Version); err != nil {
+			return err
+		}
+	}
+	if x.Uptime != 0 {
+		if err := enc.NextField(1); err != nil {
+			return err
+		}
+		var wire vdltime.Duration
+		if err := vdltime.DurationFromNative(&wire, x.Uptime); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if x.Hardware != "" {
+		if err := enc.NextFieldValueString(2, vdl.StringType, x.Hardware); err != nil {
+			return err
+		}
+	}
+	if len(x.Pins) != 0 {
+		if err := enc.NextField(3); err != nil {
+			return err
+		}
+		if err := __VDLWriteAnon_map_1(enc, x.Pins); err != nil {
+			return err
+		}
+	}
+	if x.LastHardwareError != "" {
+		if err := enc.NextFieldValueString(4, vdl.StringType, x.LastHardwareError); err != nil {
+			return err
+		}
+	}
+	if !x.LastHardwareErrorTime.IsZero() {
+		if err := enc.NextField(5); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.LastHardwareErrorTime); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if x.Actuations != 0 {
+		if err := enc.NextFieldValueUint(6, vdl.Uint64Type, x.Actuations); err != nil {
+			return err
+		}
+	}
+	if x.ConfigDirBytes != 0 {
+		if err := enc.NextFieldValueUint(7, vdl.Uint64Type, x.ConfigDirBytes); err != nil {
+			return err
+		}
+	}
+	if x.NeighborhoodName != "" {
+		if err := enc.NextFieldValueString(8, vdl.StringType, x.NeighborhoodName); err != nil {
+			return err
+		}
+	}
+	if x.BatteryLevel != 0 {
+		if err := enc.NextFieldValueFloat(9, vdl.Float64Type, x.BatteryLevel); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func __VDLWriteAnon_map_1(enc vdl.Encoder, x map[string]string) error {
+	if err := enc.StartValue(__VDLType_map_4); err != nil {
+		return err
+	}
+	if err := enc.SetLenHint(len(x)); err != nil {
+		return err
+	}
+	for key, elem := range x {
+		if err := enc.NextEntryValueString(vdl.StringType, key); err != nil {
+			return err
+		}
+		if err := enc.WriteValueString(vdl.StringType, elem); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextEntry(true); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *LockDiagnostics) VDLRead(dec vdl.Decoder) error {
+	*x = LockDiagnostics{}
+	if err := dec.StartValue(__VDLType_struct_2); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_2 {
+			index = __VDLType_struct_2.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.Version = value
+			}
+		case 1:
+			var wire vdltime.Duration
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.DurationToNative(wire, &x.Uptime); err != nil {
+				return err
+			}
+		case 2:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.Hardware = value
+			}
+		case 3:
+			if err := __VDLReadAnon_map_1(dec, &x.Pins); err != nil {
+				return err
+			}
+		case 4:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.LastHardwareError = value
+			}
+		case 5:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.LastHardwareErrorTime); err != nil {
+				return err
+			}
+		case 6:
+			switch value, err := dec.ReadValueUint(64); {
+			case err != nil:
+				return err
+			default:
+				x.Actuations = value
+			}
+		case 7:
+			switch value, err := dec.ReadValueUint(64); {
+			case err != nil:
+				return err
+			default:
+				x.ConfigDirBytes = value
+			}
+		case 8:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.NeighborhoodName = value
+			}
+		case 9:
+			switch value, err := dec.ReadValueFloat(64); {
+			case err != nil:
+				return err
+			default:
+				x.BatteryLevel = value
+			}
+		}
+	}
+}
+
+func __VDLReadAnon_map_1(dec vdl.Decoder, x *map[string]string) error {
+	if err := dec.StartValue(__VDLType_map_4); err != nil {
+		return err
+	}
+	var tmpMap map[string]string
+	if len := dec.LenHint(); len > 0 {
+		tmpMap = make(map[string]string, len)
+	}
+	for {
+		switch done, key, err := dec.NextEntryValueString(); {
+		case err != nil:
+			return err
+		case done:
+			*x = tmpMap
+			return dec.FinishValue()
+		default:
+			var elem string
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				elem = value
+			}
+			if tmpMap == nil {
+				tmpMap = make(map[string]string)
+			}
+			tmpMap[key] = elem
+		}
+	}
+}
+
 //////////////////////////////////////////////////
 // Const definitions
 
 const Locked = LockStatus(0)
 const Unlocked = LockStatus(1)
 
+// MaxDepthCaveat limits the extensions of the key that carries it to at most
+// the specified number of further blessings (0 making the key non-delegable).
+// Its validator accepts every call, and the lock enforces the depth by
+// examining the certificate chains presented to it.
+var MaxDepthCaveat = security.CaveatDescriptor{
+	Id: uniqueid.Id{
+		39,
+		178,
+		182,
+		125,
+		130,
+		41,
+		198,
+		82,
+		7,
+		22,
+		9,
+		187,
+		95,
+		127,
+		133,
+		206,
+	},
+	ParamType: vdl.Uint32Type,
+}
+
+// PINInfo describes a PIN that unlocks the lock when entered on its keypad.
+// The PIN itself is never returned by the lock.
+type PINInfo struct {
+	// Label identifies the PIN (e.g. "cleaner").
+	Label string
+	// NotBefore and NotAfter bound the period during which the PIN unlocks
+	// the lock. The period is unbounded on either side if the corresponding
+	// time is zero.
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+func (PINInfo) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.PINInfo"`
+}) {
+}
+
+func (x PINInfo) VDLIsZero() bool {
+	if x.Label != "" {
+		return false
+	}
+	if !x.NotBefore.IsZero() {
+		return false
+	}
+	if !x.NotAfter.IsZero() {
+		return false
+	}
+	return true
+}
+
+func (x PINInfo) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_6); err != nil {
+		return err
+	}
+	if x.Label != "" {
+		if err := enc.NextFieldValueString(0, vdl.StringType, x.Label); err != nil {
+			return err
+		}
+	}
+	if !x.NotBefore.IsZero() {
+		if err := enc.NextField(1); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.NotBefore); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if !x.NotAfter.IsZero() {
+		if err := enc.NextField(2); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.NotAfter); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *PINInfo) VDLRead(dec vdl.Decoder) error {
+	*x = PINInfo{}
+	if err := dec.StartValue(__VDLType_struct_6); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_6 {
+			index = __VDLType_struct_6.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.Label = value
+			}
+		case 1:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.NotBefore); err != nil {
+				return err
+			}
+		case 2:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.NotAfter); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// LockEventCause identifies what changed the state of a lock.
+type LockEventCause int
+
+const (
+	LockEventCauseRemote LockEventCause = iota
+	LockEventCauseKeypad
+	LockEventCauseManual
+	LockEventCauseAutomatic
+	LockEventCauseRestore
+	LockEventCauseAlarm
+)
+
+// LockEventCauseAll holds all labels for LockEventCause.
+var LockEventCauseAll = [...]LockEventCause{LockEventCauseRemote, LockEventCauseKeypad, LockEventCauseManual, LockEventCauseAutomatic, LockEventCauseRestore, LockEventCauseAlarm}
+
+// LockEventCauseFromString creates a LockEventCause from a string label.
+func LockEventCauseFromString(label string) (x LockEventCause, err error) {
+	err = x.Set(label)
+	return
+}
+
+// Set assigns label to x.
+func (x *LockEventCause) Set(label string) error {
+	switch label {
+	case "Remote", "remote":
+		*x = LockEventCauseRemote
+		return nil
+	case "Keypad", "keypad":
+		*x = LockEventCauseKeypad
+		return nil
+	case "Manual", "manual":
+		*x = LockEventCauseManual
+		return nil
+	case "Automatic", "automatic":
+		*x = LockEventCauseAutomatic
+		return nil
+	case "Restore", "restore":
+		*x = LockEventCauseRestore
+		return nil
+	case "Alarm", "alarm":
+		*x = LockEventCauseAlarm
+		return nil
+	}
+	*x = -1
+	return fmt.Errorf("unknown label %q in lock.LockEventCause", label)
+}
+
+// String returns the string label of x.
+func (x LockEventCause) String() string {
+	switch x {
+	case LockEventCauseRemote:
+		return "Remote"
+	case LockEventCauseKeypad:
+		return "Keypad"
+	case LockEventCauseManual:
+		return "Manual"
+	case LockEventCauseAutomatic:
+		return "Automatic"
+	case LockEventCauseRestore:
+		return "Restore"
+	case LockEventCauseAlarm:
+		return "Alarm"
+	}
+	return ""
+}
+
+func (LockEventCause) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.LockEventCause"`
+	Enum struct{ Remote, Keypad, Manual, Automatic, Restore, Alarm string }
+}) {
+}
+
+func (x LockEventCause) VDLIsZero() bool {
+	return x == LockEventCauseRemote
+}
+
+func (x LockEventCause) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.WriteValueString(__VDLType_enum_7, x.String()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (x *LockEventCause) VDLRead(dec vdl.Decoder) error {
+	switch value, err := dec.ReadValueString(); {
+	case err != nil:
+		return err
+	default:
+		if err := x.Set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockEvent describes a change of the state of a lock, or an alarm raised by
+// it.
+type LockEvent struct {
+	// Time is the time at which the lock device noticed the change.
+	Time time.Time
+	// Status is the state of the lock after the change, or when the alarm
+	// was raised.
+	Status LockStatus
+	Cause  LockEventCause
+	// Blessings are the blessing names of the caller, for Remote changes.
+	// For unlocks subject to the two-person rule (see PendingUnlock), they
+	// are followed by those of the caller that requested the unlock.
+	Blessings []string
+	// PIN is the label of the PIN entered, for Keypad changes.
+	PIN string
+	// Alarm is the alarm raised, for Alarm events.
+	Alarm Alarm
+}
+
+func (LockEvent) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.LockEvent"`
+}) {
+}
+
+func (x LockEvent) VDLIsZero() bool {
+	if !x.Time.IsZero() {
+		return false
+	}
+	if x.Status != 0 {
+		return false
+	}
+	if x.Cause != LockEventCauseRemote {
+		return false
+	}
+	if len(x.Blessings) != 0 {
+		return false
+	}
+	if x.PIN != "" {
+		return false
+	}
+	if !x.Alarm.VDLIsZero() {
+		return false
+	}
+	return true
+}
+
+func (x LockEvent) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_8); err != nil {
+		return err
+	}
+	if !x.Time.IsZero() {
+		if err := enc.NextField(0); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.Time); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if x.Status != 0 {
+		if err := enc.NextFieldValueInt(1, __VDLType_int32_1, int64(x.Status)); err != nil {
+			return err
+		}
+	}
+	if x.Cause != LockEventCauseRemote {
+		if err := enc.NextFieldValueString(2, __VDLType_enum_7, x.Cause.String()); err != nil {
+			return err
+		}
+	}
+	if len(x.Blessings) != 0 {
+		if err := enc.NextField(3); err != nil {
+			return err
+		}
+		if err := __VDLWriteAnon_list_2(enc, x.Blessings); err != nil {
+			return err
+		}
+	}
+	if x.PIN != "" {
+		if err := enc.NextFieldValueString(4, vdl.StringType, x.PIN); err != nil {
+			return err
+		}
+	}
+	if !x.Alarm.VDLIsZero() {
+		if err := enc.NextField(5); err != nil {
+			return err
+		}
+		if err := x.Alarm.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func __VDLWriteAnon_list_2(enc vdl.Encoder, x []string) error {
+	if err := enc.StartValue(__VDLType_list_9); err != nil {
+		return err
+	}
+	if err := enc.SetLenHint(len(x)); err != nil {
+		return err
+	}
+	for _, elem := range x {
+		if err := enc.NextEntryValueString(vdl.StringType, elem); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextEntry(true); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *LockEvent) VDLRead(dec vdl.Decoder) error {
+	*x = LockEvent{}
+	if err := dec.StartValue(__VDLType_struct_8); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_8 {
+			index = __VDLType_struct_8.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.Time); err != nil {
+				return err
+			}
+		case 1:
+			switch value, err := dec.ReadValueInt(32); {
+			case err != nil:
+				return err
+			default:
+				x.Status = LockStatus(value)
+			}
+		case 2:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				if err := x.Cause.Set(value); err != nil {
+					return err
+				}
+			}
+		case 3:
+			if err := __VDLReadAnon_list_2(dec, &x.Blessings); err != nil {
+				return err
+			}
+		case 4:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.PIN = value
+			}
+		case 5:
+			if err := x.Alarm.VDLRead(dec); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func __VDLReadAnon_list_2(dec vdl.Decoder, x *[]string) error {
+	if err := dec.StartValue(__VDLType_list_9); err != nil {
+		return err
+	}
+	if len := dec.LenHint(); len > 0 {
+		*x = make([]string, 0, len)
+	} else {
+		*x = nil
+	}
+	for {
+		switch done, elem, err := dec.NextEntryValueString(); {
+		case err != nil:
+			return err
+		case done:
+			return dec.FinishValue()
+		default:
+			*x = append(*x, elem)
+		}
+	}
+}
+
+// AlarmKind identifies what raised an alarm.
+type AlarmKind int
+
+const (
+	AlarmKindEnclosure AlarmKind = iota
+	AlarmKindForcedBolt
+	AlarmKindStateMismatch
+	AlarmKindKeypad
+)
+
+// AlarmKindAll holds all labels for AlarmKind.
+var AlarmKindAll = [...]AlarmKind{AlarmKindEnclosure, AlarmKindForcedBolt, AlarmKindStateMismatch, AlarmKindKeypad}
+
+// AlarmKindFromString creates a AlarmKind from a string label.
+func AlarmKindFromString(label string) (x AlarmKind, err error) {
+	err = x.Set(label)
+	return
+}
+
+// Set assigns label to x.
+func (x *AlarmKind) Set(label string) error {
+	switch label {
+	case "Enclosure", "enclosure":
+		*x = AlarmKindEnclosure
+		return nil
+	case "ForcedBolt", "forcedbolt":
+		*x = AlarmKindForcedBolt
+		return nil
+	case "StateMismatch", "statemismatch":
+		*x = AlarmKindStateMismatch
+		return nil
+	case "Keypad", "keypad":
+		*x = AlarmKindKeypad
+		return nil
+	}
+	*x = -1
+	return fmt.Errorf("unknown label %q in lock.AlarmKind", label)
+}
+
+// String returns the string label of x.
+func (x AlarmKind) String() string {
+	switch x {
+	case AlarmKindEnclosure:
+		return "Enclosure"
+	case AlarmKindForcedBolt:
+		return "ForcedBolt"
+	case AlarmKindStateMismatch:
+		return "StateMismatch"
+	case AlarmKindKeypad:
+		return "Keypad"
+	}
+	return ""
+}
+
+func (AlarmKind) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.AlarmKind"`
+	Enum struct{ Enclosure, ForcedBolt, StateMismatch, Keypad string }
+}) {
+}
+
+func (x AlarmKind) VDLIsZero() bool {
+	return x == AlarmKindEnclosure
+}
+
+func (x AlarmKind) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.WriteValueString(__VDLType_enum_10, x.String()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (x *AlarmKind) VDLRead(dec vdl.Decoder) error {
+	switch value, err := dec.ReadValueString(); {
+	case err != nil:
+		return err
+	default:
+		if err := x.Set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Alarm describes a possible attempt to tamper with a lock.
+type Alarm struct {
+	// ID identifies the alarm among the alarms of the lock.
+	ID   uint64
+	Kind AlarmKind
+	// Time is the time at which the alarm was raised.
+	Time time.Time
+	// Acknowledged is true once the owner of the lock has acknowledged the
+	// alarm with LockAdmin.AcknowledgeAlarm.
+	Acknowledged bool
+}
+
+func (Alarm) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.Alarm"`
+}) {
+}
+
+func (x Alarm) VDLIsZero() bool {
+	if x.ID != 0 {
+		return false
+	}
+	if x.Kind != AlarmKindEnclosure {
+		return false
+	}
+	if !x.Time.IsZero() {
+		return false
+	}
+	if x.Acknowledged {
+		return false
+	}
+	return true
+}
+
+func (x Alarm) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_11); err != nil {
+		return err
+	}
+	if x.ID != 0 {
+		if err := enc.NextFieldValueUint(0, vdl.Uint64Type, x.ID); err != nil {
+			return err
+		}
+	}
+	if x.Kind != AlarmKindEnclosure {
+		if err := enc.NextFieldValueString(1, __VDLType_enum_10, x.Kind.String()); err != nil {
+			return err
+		}
+	}
+	if !x.Time.IsZero() {
+		if err := enc.NextField(2); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.Time); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if x.Acknowledged {
+		if err := enc.NextFieldValueBool(3, vdl.BoolType, x.Acknowledged); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *Alarm) VDLRead(dec vdl.Decoder) error {
+	*x = Alarm{}
+	if err := dec.StartValue(__VDLType_struct_11); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_11 {
+			index = __VDLType_struct_11.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			switch value, err := dec.ReadValueUint(64); {
+			case err != nil:
+				return err
+			default:
+				x.ID = value
+			}
+		case 1:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				if err := x.Kind.Set(value); err != nil {
+					return err
+				}
+			}
+		case 2:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.Time); err != nil {
+				return err
+			}
+		case 3:
+			switch value, err := dec.ReadValueBool(); {
+			case err != nil:
+				return err
+			default:
+				x.Acknowledged = value
+			}
+		}
+	}
+}
+
+// Lockout describes a caller that is temporarily refused access to a lock
+// after too many failed attempts to claim, lock or unlock it.
+type Lockout struct {
+	// Key is the public key of the caller.
+	Key string
+	// Blessings are the blessing names presented by the caller in its most
+	// recent failed attempt.
+	Blessings []string
+	// Until is the time at which the lockout ends.
+	Until time.Time
+}
+
+func (Lockout) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.Lockout"`
+}) {
+}
+
+func (x Lockout) VDLIsZero() bool {
+	if x.Key != "" {
+		return false
+	}
+	if len(x.Blessings) != 0 {
+		return false
+	}
+	if !x.Until.IsZero() {
+		return false
+	}
+	return true
+}
+
+func (x Lockout) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_12); err != nil {
+		return err
+	}
+	if x.Key != "" {
+		if err := enc.NextFieldValueString(0, vdl.StringType, x.Key); err != nil {
+			return err
+		}
+	}
+	if len(x.Blessings) != 0 {
+		if err := enc.NextField(1); err != nil {
+			return err
+		}
+		if err := __VDLWriteAnon_list_2(enc, x.Blessings); err != nil {
+			return err
+		}
+	}
+	if !x.Until.IsZero() {
+		if err := enc.NextField(2); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.Until); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *Lockout) VDLRead(dec vdl.Decoder) error {
+	*x = Lockout{}
+	if err := dec.StartValue(__VDLType_struct_12); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_12 {
+			index = __VDLType_struct_12.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			switch value, err := dec.ReadValueString(); {
+			case err != nil:
+				return err
+			default:
+				x.Key = value
+			}
+		case 1:
+			if err := __VDLReadAnon_list_2(dec, &x.Blessings); err != nil {
+				return err
+			}
+		case 2:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.Until); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PendingUnlock describes a request to unlock a lock that is subject to the
+// two-person rule: the lock is only unlocked once a second key holder, with
+// blessings distinct from those of the first, also calls Lock.Unlock before
+// the request expires.
+type PendingUnlock struct {
+	// Blessings are the blessing names of the caller that requested the
+	// unlock.
+	Blessings []string
+	// Time is the time at which the unlock was requested.
+	Time time.Time
+	// Expires is the time after which the request can no longer be confirmed.
+	Expires time.Time
+}
+
+func (PendingUnlock) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.PendingUnlock"`
+}) {
+}
+
+func (x PendingUnlock) VDLIsZero() bool {
+	if len(x.Blessings) != 0 {
+		return false
+	}
+	if !x.Time.IsZero() {
+		return false
+	}
+	if !x.Expires.IsZero() {
+		return false
+	}
+	return true
+}
+
+func (x PendingUnlock) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_13); err != nil {
+		return err
+	}
+	if len(x.Blessings) != 0 {
+		if err := enc.NextField(0); err != nil {
+			return err
+		}
+		if err := __VDLWriteAnon_list_2(enc, x.Blessings); err != nil {
+			return err
+		}
+	}
+	if !x.Time.IsZero() {
+		if err := enc.NextField(1); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.Time); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if !x.Expires.IsZero() {
+		if err := enc.NextField(2); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.Expires); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *PendingUnlock) VDLRead(dec vdl.Decoder) error {
+	*x = PendingUnlock{}
+	if err := dec.StartValue(__VDLType_struct_13); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_13 {
+			index = __VDLType_struct_13.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			if err := __VDLReadAnon_list_2(dec, &x.Blessings); err != nil {
+				return err
+			}
+		case 1:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.Time); err != nil {
+				return err
+			}
+		case 2:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.Expires); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// KeyHolder describes a distinct set of blessings with which a key holder
+// has called the lock.
+type KeyHolder struct {
+	// Blessings are the blessing names that the key holder presented.
+	Blessings []string
+	// FirstSeen and LastSeen are the times of the first and most recent
+	// calls with these blessings.
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Uses is the number of calls made with these blessings.
+	Uses uint64
+}
+
+func (KeyHolder) VDLReflect(struct {
+	Name string `vdl:"v.io/x/lock.KeyHolder"`
+}) {
+}
+
+func (x KeyHolder) VDLIsZero() bool {
+	if len(x.Blessings) != 0 {
+		return false
+	}
+	if !x.FirstSeen.IsZero() {
+		return false
+	}
+	if !x.LastSeen.IsZero() {
+		return false
+	}
+	if x.Uses != 0 {
+		return false
+	}
+	return true
+}
+
+func (x KeyHolder) VDLWrite(enc vdl.Encoder) error {
+	if err := enc.StartValue(__VDLType_struct_14); err != nil {
+		return err
+	}
+	if len(x.Blessings) != 0 {
+		if err := enc.NextField(0); err != nil {
+			return err
+		}
+		if err := __VDLWriteAnon_list_2(enc, x.Blessings); err != nil {
+			return err
+		}
+	}
+	if !x.FirstSeen.IsZero() {
+		if err := enc.NextField(1); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.FirstSeen); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if !x.LastSeen.IsZero() {
+		if err := enc.NextField(2); err != nil {
+			return err
+		}
+		var wire vdltime.Time
+		if err := vdltime.TimeFromNative(&wire, x.LastSeen); err != nil {
+			return err
+		}
+		if err := wire.VDLWrite(enc); err != nil {
+			return err
+		}
+	}
+	if x.Uses != 0 {
+		if err := enc.NextFieldValueUint(3, vdl.Uint64Type, x.Uses); err != nil {
+			return err
+		}
+	}
+	if err := enc.NextField(-1); err != nil {
+		return err
+	}
+	return enc.FinishValue()
+}
+
+func (x *KeyHolder) VDLRead(dec vdl.Decoder) error {
+	*x = KeyHolder{}
+	if err := dec.StartValue(__VDLType_struct_14); err != nil {
+		return err
+	}
+	decType := dec.Type()
+	for {
+		index, err := dec.NextField()
+		switch {
+		case err != nil:
+			return err
+		case index == -1:
+			return dec.FinishValue()
+		}
+		if decType != __VDLType_struct_14 {
+			index = __VDLType_struct_14.FieldIndexByName(decType.Field(index).Name)
+			if index == -1 {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		switch index {
+		case 0:
+			if err := __VDLReadAnon_list_2(dec, &x.Blessings); err != nil {
+				return err
+			}
+		case 1:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.FirstSeen); err != nil {
+				return err
+			}
+		case 2:
+			var wire vdltime.Time
+			if err := wire.VDLRead(dec); err != nil {
+				return err
+			}
+			if err := vdltime.TimeToNative(wire, &x.LastSeen); err != nil {
+				return err
+			}
+		case 3:
+			switch value, err := dec.ReadValueUint(64); {
+			case err != nil:
+				return err
+			default:
+				x.Uses = value
+			}
+		}
+	}
+}
+
 //////////////////////////////////////////////////
 // Interface definitions
 
@@ -206,8 +1537,10 @@ var descUnclaimedLock = rpc.InterfaceDesc{
 //
 // Lock is the interface for managing a physical lock.
 //
-// Only principals that present a blessing obtained by a call to UnclaimedLock.Claim,
-// or an extension of it, will be authorized.
+// Methods are authorized by the permissions of the lock (see
+// LockAdmin.GetPermissions) according to their access tags. By default,
+// principals that present a blessing obtained by a call to UnclaimedLock.Claim,
+// or an extension of it, are granted Read and Write.
 type LockClientMethods interface {
 	// Lock locks the lock.
 	Lock(*context.T, ...rpc.CallOpt) error
@@ -216,6 +1549,17 @@ type LockClientMethods interface {
 	// Status returns the current status (locked or unlocked) of the
 	// lock.
 	Status(*context.T, ...rpc.CallOpt) (LockStatus, error)
+	// Alarms returns the alarms raised by the lock, most recent first. It
+	// requires Admin, as alarms reveal attempts to tamper with the lock.
+	Alarms(*context.T, ...rpc.CallOpt) ([]Alarm, error)
+	// BatteryLevel returns the remaining charge of the battery of the lock,
+	// as a fraction of its capacity. It fails with verror.ErrNoExist if the
+	// lock cannot sense its battery.
+	BatteryLevel(*context.T, ...rpc.CallOpt) (float64, error)
+	// PendingUnlock returns the pending request to unlock the lock, if it is
+	// subject to the two-person rule. It fails with verror.ErrNoExist if
+	// there is none.
+	PendingUnlock(*context.T, ...rpc.CallOpt) (PendingUnlock, error)
 }
 
 // LockClientStub adds universal methods to LockClientMethods.
@@ -248,13 +1592,30 @@ func (c implLockClientStub) Status(ctx *context.T, opts ...rpc.CallOpt) (o0 Lock
 	return
 }
 
+func (c implLockClientStub) Alarms(ctx *context.T, opts ...rpc.CallOpt) (o0 []Alarm, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Alarms", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockClientStub) BatteryLevel(ctx *context.T, opts ...rpc.CallOpt) (o0 float64, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "BatteryLevel", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockClientStub) PendingUnlock(ctx *context.T, opts ...rpc.CallOpt) (o0 PendingUnlock, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "PendingUnlock", nil, []interface{}{&o0}, opts...)
+	return
+}
+
 // LockServerMethods is the interface a server writer
 // implements for Lock.
 //
 // Lock is the interface for managing a physical lock.
 //
-// Only principals that present a blessing obtained by a call to UnclaimedLock.Claim,
-// or an extension of it, will be authorized.
+// Methods are authorized by the permissions of the lock (see
+// LockAdmin.GetPermissions) according to their access tags. By default,
+// principals that present a blessing obtained by a call to UnclaimedLock.Claim,
+// or an extension of it, are granted Read and Write.
 type LockServerMethods interface {
 	// Lock locks the lock.
 	Lock(*context.T, rpc.ServerCall) error
@@ -263,6 +1624,17 @@ type LockServerMethods interface {
 	// Status returns the current status (locked or unlocked) of the
 	// lock.
 	Status(*context.T, rpc.ServerCall) (LockStatus, error)
+	// Alarms returns the alarms raised by the lock, most recent first. It
+	// requires Admin, as alarms reveal attempts to tamper with the lock.
+	Alarms(*context.T, rpc.ServerCall) ([]Alarm, error)
+	// BatteryLevel returns the remaining charge of the battery of the lock,
+	// as a fraction of its capacity. It fails with verror.ErrNoExist if the
+	// lock cannot sense its battery.
+	BatteryLevel(*context.T, rpc.ServerCall) (float64, error)
+	// PendingUnlock returns the pending request to unlock the lock, if it is
+	// subject to the two-person rule. It fails with verror.ErrNoExist if
+	// there is none.
+	PendingUnlock(*context.T, rpc.ServerCall) (PendingUnlock, error)
 }
 
 // LockServerStubMethods is the server interface containing
@@ -312,6 +1684,18 @@ func (s implLockServerStub) Status(ctx *context.T, call rpc.ServerCall) (LockSta
 	return s.impl.Status(ctx, call)
 }
 
+func (s implLockServerStub) Alarms(ctx *context.T, call rpc.ServerCall) ([]Alarm, error) {
+	return s.impl.Alarms(ctx, call)
+}
+
+func (s implLockServerStub) BatteryLevel(ctx *context.T, call rpc.ServerCall) (float64, error) {
+	return s.impl.BatteryLevel(ctx, call)
+}
+
+func (s implLockServerStub) PendingUnlock(ctx *context.T, call rpc.ServerCall) (PendingUnlock, error) {
+	return s.impl.PendingUnlock(ctx, call)
+}
+
 func (s implLockServerStub) Globber() *rpc.GlobState {
 	return s.gs
 }
@@ -327,15 +1711,17 @@ var LockDesc rpc.InterfaceDesc = descLock
 var descLock = rpc.InterfaceDesc{
 	Name:    "Lock",
 	PkgPath: "v.io/x/lock",
-	Doc:     "// Lock is the interface for managing a physical lock.\n//\n// Only principals that present a blessing obtained by a call to UnclaimedLock.Claim,\n// or an extension of it, will be authorized.",
+	Doc:     "// Lock is the interface for managing a physical lock.\n//\n// Methods are authorized by the permissions of the lock (see\n// LockAdmin.GetPermissions) according to their access tags. By default,\n// principals that present a blessing obtained by a call to UnclaimedLock.Claim,\n// or an extension of it, are granted Read and Write.",
 	Methods: []rpc.MethodDesc{
 		{
 			Name: "Lock",
 			Doc:  "// Lock locks the lock.",
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Write"))},
 		},
 		{
 			Name: "Unlock",
 			Doc:  "// Unlock unlocks the lock.",
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Write"))},
 		},
 		{
 			Name: "Status",
@@ -343,13 +1729,520 @@ var descLock = rpc.InterfaceDesc{
 			OutArgs: []rpc.ArgDesc{
 				{"", ``}, // LockStatus
 			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Read"))},
+		},
+		{
+			Name: "Alarms",
+			Doc:  "// Alarms returns the alarms raised by the lock, most recent first. It\n// requires Admin, as alarms reveal attempts to tamper with the lock.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // []Alarm
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "BatteryLevel",
+			Doc:  "// BatteryLevel returns the remaining charge of the battery of the lock,\n// as a fraction of its capacity. It fails with verror.ErrNoExist if the\n// lock cannot sense its battery.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // float64
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Read"))},
+		},
+		{
+			Name: "PendingUnlock",
+			Doc:  "// PendingUnlock returns the pending request to unlock the lock, if it is\n// subject to the two-person rule. It fails with verror.ErrNoExist if\n// there is none.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // PendingUnlock
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Read"))},
+		},
+	},
+}
+
+// LockAdminClientMethods is the client interface
+// containing LockAdmin methods.
+//
+// LockAdmin is the interface for administering a claimed lock device.
+//
+// Its methods require Admin in the permissions of the lock, which is granted by
+// default, and always, to the principal that presents the blessing obtained by
+// a call to UnclaimedLock.Claim, and not an extension of it.
+type LockAdminClientMethods interface {
+	// Diagnostics returns information for troubleshooting the device.
+	Diagnostics(*context.T, ...rpc.CallOpt) (LockDiagnostics, error)
+	// AddPIN makes 'pin' unlock the lock when entered on its keypad, during
+	// the period described by 'info'. It fails if the lock already has a PIN
+	// with the label info.Label.
+	AddPIN(_ *context.T, pin string, info PINInfo, _ ...rpc.CallOpt) error
+	// RemovePIN removes the PIN with the provided label.
+	RemovePIN(_ *context.T, label string, _ ...rpc.CallOpt) error
+	// ListPINs describes the PINs of the lock.
+	ListPINs(*context.T, ...rpc.CallOpt) ([]PINInfo, error)
+	// Watch streams an event for every subsequent change of the state of
+	// the lock, whatever its cause, and for every alarm it raises, until the
+	// call is canceled.
+	Watch(*context.T, ...rpc.CallOpt) (LockAdminWatchClientCall, error)
+	// AcknowledgeAlarm marks the alarm with the provided ID as acknowledged.
+	AcknowledgeAlarm(_ *context.T, id uint64, _ ...rpc.CallOpt) error
+	// Lockouts returns the callers that are currently locked out after too
+	// many failed attempts to claim, lock or unlock the lock.
+	Lockouts(*context.T, ...rpc.CallOpt) ([]Lockout, error)
+	// ListKeyHolders returns the key holders that have called the lock,
+	// so that stale keys can be found and revoked.
+	ListKeyHolders(*context.T, ...rpc.CallOpt) ([]KeyHolder, error)
+	// GetPermissions returns the permissions of the lock, which authorize
+	// the methods of Lock and LockAdmin according to their access tags,
+	// along with their version.
+	GetPermissions(*context.T, ...rpc.CallOpt) (perms access.Permissions, version string, _ error)
+	// SetPermissions replaces the permissions of the lock, unless version
+	// is set and differs from their current version. The permissions must
+	// grant Admin to the principal that claimed the lock.
+	SetPermissions(_ *context.T, perms access.Permissions, version string, _ ...rpc.CallOpt) error
+}
+
+// LockAdminClientStub adds universal methods to LockAdminClientMethods.
+type LockAdminClientStub interface {
+	LockAdminClientMethods
+	rpc.UniversalServiceMethods
+}
+
+// LockAdminClient returns a client stub for LockAdmin.
+func LockAdminClient(name string) LockAdminClientStub {
+	return implLockAdminClientStub{name}
+}
+
+type implLockAdminClientStub struct {
+	name string
+}
+
+func (c implLockAdminClientStub) Diagnostics(ctx *context.T, opts ...rpc.CallOpt) (o0 LockDiagnostics, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Diagnostics", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) AddPIN(ctx *context.T, i0 string, i1 PINInfo, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "AddPIN", []interface{}{i0, i1}, nil, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) RemovePIN(ctx *context.T, i0 string, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "RemovePIN", []interface{}{i0}, nil, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) ListPINs(ctx *context.T, opts ...rpc.CallOpt) (o0 []PINInfo, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "ListPINs", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) Watch(ctx *context.T, opts ...rpc.CallOpt) (ocall LockAdminWatchClientCall, err error) {
+	var call rpc.ClientCall
+	if call, err = v23.GetClient(ctx).StartCall(ctx, c.name, "Watch", nil, opts...); err != nil {
+		return
+	}
+	ocall = &implLockAdminWatchClientCall{ClientCall: call}
+	return
+}
+
+func (c implLockAdminClientStub) AcknowledgeAlarm(ctx *context.T, i0 uint64, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "AcknowledgeAlarm", []interface{}{i0}, nil, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) Lockouts(ctx *context.T, opts ...rpc.CallOpt) (o0 []Lockout, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Lockouts", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) ListKeyHolders(ctx *context.T, opts ...rpc.CallOpt) (o0 []KeyHolder, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "ListKeyHolders", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) GetPermissions(ctx *context.T, opts ...rpc.CallOpt) (o0 access.Permissions, o1 string, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "GetPermissions", nil, []interface{}{&o0, &o1}, opts...)
+	return
+}
+
+func (c implLockAdminClientStub) SetPermissions(ctx *context.T, i0 access.Permissions, i1 string, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "SetPermissions", []interface{}{i0, i1}, nil, opts...)
+	return
+}
+
+// LockAdminWatchClientStream is the client stream for LockAdmin.Watch.
+type LockAdminWatchClientStream interface {
+	// RecvStream returns the receiver side of the LockAdmin.Watch client stream.
+	RecvStream() interface {
+		// Advance stages an item so that it may be retrieved via Value.  Returns
+		// true iff there is an item to retrieve.  Advance must be called before
+		// Value is called.  May block if an item is not available.
+		Advance() bool
+		// Value returns the item that was staged by Advance.  May panic if Advance
+		// returned false or was not called.  Never blocks.
+		Value() LockEvent
+		// Err returns any error encountered by Advance.  Never blocks.
+		Err() error
+	}
+}
+
+// LockAdminWatchClientCall represents the call returned from LockAdmin.Watch.
+type LockAdminWatchClientCall interface {
+	LockAdminWatchClientStream
+	// Finish blocks until the server is done, and returns the positional return
+	// values for call.
+	//
+	// Finish returns immediately if the call has been canceled; depending on the
+	// timing the output could either be an error signaling cancelation, or the
+	// valid positional return values from the server.
+	//
+	// Calling Finish is mandatory for releasing stream resources, unless the call
+	// has been canceled or any of the other methods return an error.  Finish should
+	// be called at most once.
+	Finish() error
+}
+
+type implLockAdminWatchClientCall struct {
+	rpc.ClientCall
+	valRecv LockEvent
+	errRecv error
+}
+
+func (c *implLockAdminWatchClientCall) RecvStream() interface {
+	Advance() bool
+	Value() LockEvent
+	Err() error
+} {
+	return implLockAdminWatchClientCallRecv{c}
+}
+
+type implLockAdminWatchClientCallRecv struct {
+	c *implLockAdminWatchClientCall
+}
+
+func (c implLockAdminWatchClientCallRecv) Advance() bool {
+	c.c.valRecv = LockEvent{}
+	c.c.errRecv = c.c.Recv(&c.c.valRecv)
+	return c.c.errRecv == nil
+}
+func (c implLockAdminWatchClientCallRecv) Value() LockEvent {
+	return c.c.valRecv
+}
+func (c implLockAdminWatchClientCallRecv) Err() error {
+	if c.c.errRecv == io.EOF {
+		return nil
+	}
+	return c.c.errRecv
+}
+func (c *implLockAdminWatchClientCall) Finish() (err error) {
+	err = c.ClientCall.Finish()
+	return
+}
+
+// LockAdminServerMethods is the interface a server writer
+// implements for LockAdmin.
+//
+// LockAdmin is the interface for administering a claimed lock device.
+//
+// Its methods require Admin in the permissions of the lock, which is granted by
+// default, and always, to the principal that presents the blessing obtained by
+// a call to UnclaimedLock.Claim, and not an extension of it.
+type LockAdminServerMethods interface {
+	// Diagnostics returns information for troubleshooting the device.
+	Diagnostics(*context.T, rpc.ServerCall) (LockDiagnostics, error)
+	// AddPIN makes 'pin' unlock the lock when entered on its keypad, during
+	// the period described by 'info'. It fails if the lock already has a PIN
+	// with the label info.Label.
+	AddPIN(_ *context.T, _ rpc.ServerCall, pin string, info PINInfo) error
+	// RemovePIN removes the PIN with the provided label.
+	RemovePIN(_ *context.T, _ rpc.ServerCall, label string) error
+	// ListPINs describes the PINs of the lock.
+	ListPINs(*context.T, rpc.ServerCall) ([]PINInfo, error)
+	// Watch streams an event for every subsequent change of the state of
+	// the lock, whatever its cause, and for every alarm it raises, until the
+	// call is canceled.
+	Watch(*context.T, LockAdminWatchServerCall) error
+	// AcknowledgeAlarm marks the alarm with the provided ID as acknowledged.
+	AcknowledgeAlarm(_ *context.T, _ rpc.ServerCall, id uint64) error
+	// Lockouts returns the callers that are currently locked out after too
+	// many failed attempts to claim, lock or unlock the lock.
+	Lockouts(*context.T, rpc.ServerCall) ([]Lockout, error)
+	// ListKeyHolders returns the key holders that have called the lock,
+	// so that stale keys can be found and revoked.
+	ListKeyHolders(*context.T, rpc.ServerCall) ([]KeyHolder, error)
+	// GetPermissions returns the permissions of the lock, which authorize
+	// the methods of Lock and LockAdmin according to their access tags,
+	// along with their version.
+	GetPermissions(*context.T, rpc.ServerCall) (perms access.Permissions, version string, _ error)
+	// SetPermissions replaces the permissions of the lock, unless version
+	// is set and differs from their current version. The permissions must
+	// grant Admin to the principal that claimed the lock.
+	SetPermissions(_ *context.T, _ rpc.ServerCall, perms access.Permissions, version string) error
+}
+
+// LockAdminServerStubMethods is the server interface containing
+// LockAdmin methods, as expected by rpc.Server.
+// The only difference between this interface and LockAdminServerMethods
+// is the streaming methods.
+type LockAdminServerStubMethods interface {
+	// Diagnostics returns information for troubleshooting the device.
+	Diagnostics(*context.T, rpc.ServerCall) (LockDiagnostics, error)
+	// AddPIN makes 'pin' unlock the lock when entered on its keypad, during
+	// the period described by 'info'. It fails if the lock already has a PIN
+	// with the label info.Label.
+	AddPIN(_ *context.T, _ rpc.ServerCall, pin string, info PINInfo) error
+	// RemovePIN removes the PIN with the provided label.
+	RemovePIN(_ *context.T, _ rpc.ServerCall, label string) error
+	// ListPINs describes the PINs of the lock.
+	ListPINs(*context.T, rpc.ServerCall) ([]PINInfo, error)
+	// Watch streams an event for every subsequent change of the state of
+	// the lock, whatever its cause, and for every alarm it raises, until the
+	// call is canceled.
+	Watch(*context.T, *LockAdminWatchServerCallStub) error
+	// AcknowledgeAlarm marks the alarm with the provided ID as acknowledged.
+	AcknowledgeAlarm(_ *context.T, _ rpc.ServerCall, id uint64) error
+	// Lockouts returns the callers that are currently locked out after too
+	// many failed attempts to claim, lock or unlock the lock.
+	Lockouts(*context.T, rpc.ServerCall) ([]Lockout, error)
+	// ListKeyHolders returns the key holders that have called the lock,
+	// so that stale keys can be found and revoked.
+	ListKeyHolders(*context.T, rpc.ServerCall) ([]KeyHolder, error)
+	// GetPermissions returns the permissions of the lock, which authorize
+	// the methods of Lock and LockAdmin according to their access tags,
+	// along with their version.
+	GetPermissions(*context.T, rpc.ServerCall) (perms access.Permissions, version string, _ error)
+	// SetPermissions replaces the permissions of the lock, unless version
+	// is set and differs from their current version. The permissions must
+	// grant Admin to the principal that claimed the lock.
+	SetPermissions(_ *context.T, _ rpc.ServerCall, perms access.Permissions, version string) error
+}
+
+// LockAdminServerStub adds universal methods to LockAdminServerStubMethods.
+type LockAdminServerStub interface {
+	LockAdminServerStubMethods
+	// Describe the LockAdmin interfaces.
+	Describe__() []rpc.InterfaceDesc
+}
+
+// LockAdminServer returns a server stub for LockAdmin.
+// It converts an implementation of LockAdminServerMethods into
+// an object that may be used by rpc.Server.
+func LockAdminServer(impl LockAdminServerMethods) LockAdminServerStub {
+	stub := implLockAdminServerStub{
+		impl: impl,
+	}
+	// Initialize GlobState; always check the stub itself first, to handle the
+	// case where the user has the Glob method defined in their VDL source.
+	if gs := rpc.NewGlobState(stub); gs != nil {
+		stub.gs = gs
+	} else if gs := rpc.NewGlobState(impl); gs != nil {
+		stub.gs = gs
+	}
+	return stub
+}
+
+type implLockAdminServerStub struct {
+	impl LockAdminServerMethods
+	gs   *rpc.GlobState
+}
+
+func (s implLockAdminServerStub) Diagnostics(ctx *context.T, call rpc.ServerCall) (LockDiagnostics, error) {
+	return s.impl.Diagnostics(ctx, call)
+}
+
+func (s implLockAdminServerStub) AddPIN(ctx *context.T, call rpc.ServerCall, i0 string, i1 PINInfo) error {
+	return s.impl.AddPIN(ctx, call, i0, i1)
+}
+
+func (s implLockAdminServerStub) RemovePIN(ctx *context.T, call rpc.ServerCall, i0 string) error {
+	return s.impl.RemovePIN(ctx, call, i0)
+}
+
+func (s implLockAdminServerStub) ListPINs(ctx *context.T, call rpc.ServerCall) ([]PINInfo, error) {
+	return s.impl.ListPINs(ctx, call)
+}
+
+func (s implLockAdminServerStub) Watch(ctx *context.T, call *LockAdminWatchServerCallStub) error {
+	return s.impl.Watch(ctx, call)
+}
+
+func (s implLockAdminServerStub) AcknowledgeAlarm(ctx *context.T, call rpc.ServerCall, i0 uint64) error {
+	return s.impl.AcknowledgeAlarm(ctx, call, i0)
+}
+
+func (s implLockAdminServerStub) Lockouts(ctx *context.T, call rpc.ServerCall) ([]Lockout, error) {
+	return s.impl.Lockouts(ctx, call)
+}
+
+func (s implLockAdminServerStub) ListKeyHolders(ctx *context.T, call rpc.ServerCall) ([]KeyHolder, error) {
+	return s.impl.ListKeyHolders(ctx, call)
+}
+
+func (s implLockAdminServerStub) GetPermissions(ctx *context.T, call rpc.ServerCall) (access.Permissions, string, error) {
+	return s.impl.GetPermissions(ctx, call)
+}
+
+func (s implLockAdminServerStub) SetPermissions(ctx *context.T, call rpc.ServerCall, i0 access.Permissions, i1 string) error {
+	return s.impl.SetPermissions(ctx, call, i0, i1)
+}
+
+func (s implLockAdminServerStub) Globber() *rpc.GlobState {
+	return s.gs
+}
+
+func (s implLockAdminServerStub) Describe__() []rpc.InterfaceDesc {
+	return []rpc.InterfaceDesc{LockAdminDesc}
+}
+
+// LockAdminDesc describes the LockAdmin interface.
+var LockAdminDesc rpc.InterfaceDesc = descLockAdmin
+
+// descLockAdmin hides the desc to keep godoc clean.
+var descLockAdmin = rpc.InterfaceDesc{
+	Name:    "LockAdmin",
+	PkgPath: "v.io/x/lock",
+	Doc:     "// LockAdmin is the interface for administering a claimed lock device.\n//\n// Its methods require Admin in the permissions of the lock, which is granted by\n// default, and always, to the principal that presents the blessing obtained by\n// a call to UnclaimedLock.Claim, and not an extension of it.",
+	Methods: []rpc.MethodDesc{
+		{
+			Name: "Diagnostics",
+			Doc:  "// Diagnostics returns information for troubleshooting the device.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // LockDiagnostics
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "AddPIN",
+			Doc:  "// AddPIN makes 'pin' unlock the lock when entered on its keypad, during\n// the period described by 'info'. It fails if the lock already has a PIN\n// with the label info.Label.",
+			InArgs: []rpc.ArgDesc{
+				{"pin", ``},  // string
+				{"info", ``}, // PINInfo
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "RemovePIN",
+			Doc:  "// RemovePIN removes the PIN with the provided label.",
+			InArgs: []rpc.ArgDesc{
+				{"label", ``}, // string
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "ListPINs",
+			Doc:  "// ListPINs describes the PINs of the lock.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // []PINInfo
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "Watch",
+			Doc:  "// Watch streams an event for every subsequent change of the state of\n// the lock, whatever its cause, and for every alarm it raises, until the\n// call is canceled.",
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "AcknowledgeAlarm",
+			Doc:  "// AcknowledgeAlarm marks the alarm with the provided ID as acknowledged.",
+			InArgs: []rpc.ArgDesc{
+				{"id", ``}, // uint64
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "Lockouts",
+			Doc:  "// Lockouts returns the callers that are currently locked out after too\n// many failed attempts to claim, lock or unlock the lock.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // []Lockout
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "ListKeyHolders",
+			Doc:  "// ListKeyHolders returns the key holders that have called the lock,\n// so that stale keys can be found and revoked.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // []KeyHolder
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "GetPermissions",
+			Doc:  "// GetPermissions returns the permissions of the lock, which authorize\n// the methods of Lock and LockAdmin according to their access tags,\n// along with their version.",
+			OutArgs: []rpc.ArgDesc{
+				{"perms", ``},   // access.Permissions
+				{"version", ``}, // string
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
+		},
+		{
+			Name: "SetPermissions",
+			Doc:  "// SetPermissions replaces the permissions of the lock, unless version\n// is set and differs from their current version. The permissions must\n// grant Admin to the principal that claimed the lock.",
+			InArgs: []rpc.ArgDesc{
+				{"perms", ``},   // access.Permissions
+				{"version", ``}, // string
+			},
+			Tags: []*vdl.Value{vdl.ValueOf(access.Tag("Admin"))},
 		},
 	},
 }
 
+// LockAdminWatchServerStream is the server stream for LockAdmin.Watch.
+type LockAdminWatchServerStream interface {
+	// SendStream returns the send side of the LockAdmin.Watch server stream.
+	SendStream() interface {
+		// Send places the item onto the output stream.  Returns errors encountered
+		// while sending.  Blocks if there is no buffer space; will unblock when
+		// buffer space is available.
+		Send(item LockEvent) error
+	}
+}
+
+// LockAdminWatchServerCall represents the context passed to LockAdmin.Watch.
+type LockAdminWatchServerCall interface {
+	rpc.ServerCall
+	LockAdminWatchServerStream
+}
+
+// LockAdminWatchServerCallStub is a wrapper that converts rpc.StreamServerCall into
+// a typesafe stub that implements LockAdminWatchServerCall.
+type LockAdminWatchServerCallStub struct {
+	rpc.StreamServerCall
+}
+
+// Init initializes LockAdminWatchServerCallStub from rpc.StreamServerCall.
+func (s *LockAdminWatchServerCallStub) Init(call rpc.StreamServerCall) {
+	s.StreamServerCall = call
+}
+
+// SendStream returns the send side of the LockAdmin.Watch server stream.
+func (s *LockAdminWatchServerCallStub) SendStream() interface {
+	Send(item LockEvent) error
+} {
+	return implLockAdminWatchServerCallSend{s}
+}
+
+type implLockAdminWatchServerCallSend struct {
+	s *LockAdminWatchServerCallStub
+}
+
+func (s implLockAdminWatchServerCallSend) Send(item LockEvent) error {
+	return s.s.Send(item)
+}
+
 // Hold type definitions in package-level variables, for better performance.
 var (
-	__VDLType_int32_1 *vdl.Type
+	__VDLType_int32_1   *vdl.Type
+	__VDLType_struct_2  *vdl.Type
+	__VDLType_struct_3  *vdl.Type
+	__VDLType_map_4     *vdl.Type
+	__VDLType_struct_5  *vdl.Type
+	__VDLType_struct_6  *vdl.Type
+	__VDLType_enum_7    *vdl.Type
+	__VDLType_struct_8  *vdl.Type
+	__VDLType_list_9    *vdl.Type
+	__VDLType_enum_10   *vdl.Type
+	__VDLType_struct_11 *vdl.Type
+	__VDLType_struct_12 *vdl.Type
+	__VDLType_struct_13 *vdl.Type
+	__VDLType_struct_14 *vdl.Type
 )
 
 var __VDLInitCalled bool
@@ -375,9 +2268,31 @@ func __VDLInit() struct{} {
 
 	// Register types.
 	vdl.Register((*LockStatus)(nil))
+	vdl.Register((*LockDiagnostics)(nil))
+	vdl.Register((*PINInfo)(nil))
+	vdl.Register((*LockEventCause)(nil))
+	vdl.Register((*LockEvent)(nil))
+	vdl.Register((*AlarmKind)(nil))
+	vdl.Register((*Alarm)(nil))
+	vdl.Register((*Lockout)(nil))
+	vdl.Register((*PendingUnlock)(nil))
+	vdl.Register((*KeyHolder)(nil))
 
 	// Initialize type definitions.
 	__VDLType_int32_1 = vdl.TypeOf((*LockStatus)(nil))
+	__VDLType_struct_2 = vdl.TypeOf((*LockDiagnostics)(nil)).Elem()
+	__VDLType_struct_3 = vdl.TypeOf((*vdltime.Duration)(nil)).Elem()
+	__VDLType_map_4 = vdl.TypeOf((*map[string]string)(nil))
+	__VDLType_struct_5 = vdl.TypeOf((*vdltime.Time)(nil)).Elem()
+	__VDLType_struct_6 = vdl.TypeOf((*PINInfo)(nil)).Elem()
+	__VDLType_enum_7 = vdl.TypeOf((*LockEventCause)(nil))
+	__VDLType_struct_8 = vdl.TypeOf((*LockEvent)(nil)).Elem()
+	__VDLType_list_9 = vdl.TypeOf((*[]string)(nil))
+	__VDLType_enum_10 = vdl.TypeOf((*AlarmKind)(nil))
+	__VDLType_struct_11 = vdl.TypeOf((*Alarm)(nil)).Elem()
+	__VDLType_struct_12 = vdl.TypeOf((*Lockout)(nil)).Elem()
+	__VDLType_struct_13 = vdl.TypeOf((*PendingUnlock)(nil)).Elem()
+	__VDLType_struct_14 = vdl.TypeOf((*KeyHolder)(nil)).Elem()
 
 	return struct{}{}
 }
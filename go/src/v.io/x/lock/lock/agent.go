@@ -0,0 +1,355 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/security"
+	"v.io/v23/verror"
+
+	"v.io/x/lib/cmdline"
+	"v.io/x/lock/locklib"
+	"v.io/x/ref/lib/signals"
+)
+
+func runAgent(ctx *context.T, env *cmdline.Env, args []string) error {
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	service := &agentService{env: env, requests: make(map[uint64]keyRequest)}
+	_, server, err := v23.WithNewServer(ctx, locklib.AgentSuffix, service, security.AllowEveryone())
+	if err != nil {
+		return fmt.Errorf("failed to create server for agent: %v", err)
+	}
+	defer func() {
+		cancel()
+		<-server.Closed()
+	}()
+	fmt.Println("Waiting for requests")
+	<-signals.ShutdownOnSignals(ctx)
+	return nil
+}
+
+func runRequest(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <user>, provided %d", numargs)
+	}
+	lockName, user := args[0], args[1]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	service := &recvKeyService{
+		env:      env,
+		notify:   make(chan error),
+		lockName: lockName,
+		sender:   user,
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	_, server, err := v23.WithNewServer(ctx, recvKeySuffix, service, security.AllowEveryone())
+	if err != nil {
+		return fmt.Errorf("failed to create server to receive keys: %v", err)
+	}
+	defer func() {
+		cancel()
+		<-server.Closed()
+	}()
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Minute)
+	defer callCancel()
+	var id uint64
+	if err := v23.GetClient(ctx).Call(callCtx, agentObjName(user), "RequestKey", []interface{}{lockName}, []interface{}{&id}); err != nil {
+		return fmt.Errorf("failed to request key from %q: %v", user, err)
+	}
+	fmt.Printf("Requested key for lock %v from user %v (request %d), waiting for the key\n", lockName, user, id)
+	return <-service.notify
+}
+
+func runRequests(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 0 {
+		return fmt.Errorf("requires no arguments, provided %d", numargs)
+	}
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	var requests []keyRequest
+	if err := v23.GetClient(ctx).Call(ctx, agentObjName(localUser(ctx)), "ListRequests", nil, []interface{}{&requests}); err != nil {
+		return fmt.Errorf("failed to list requests (is the agent running?): %v", err)
+	}
+	for _, r := range requests {
+		fmt.Printf("%d %v %v %v\n", r.ID, r.Time.Format(time.RFC3339), r.Lock, r.User)
+	}
+	return nil
+}
+
+func runApprove(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <id> <category>, provided %d", numargs)
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request ID %q: %v", args[0], err)
+	}
+	category := args[1]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := v23.GetClient(ctx).Call(ctx, agentObjName(localUser(ctx)), "ApproveRequest", []interface{}{id, category, flagApproveExpiry}, nil); err != nil {
+		return fmt.Errorf("failed to approve request %d: %v", id, err)
+	}
+	fmt.Printf("Request %d approved\n", id)
+	return nil
+}
+
+func runDeny(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one argument <id>, provided %d", numargs)
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request ID %q: %v", args[0], err)
+	}
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := v23.GetClient(ctx).Call(ctx, agentObjName(localUser(ctx)), "DenyRequest", []interface{}{id}, nil); err != nil {
+		return fmt.Errorf("failed to deny request %d: %v", id, err)
+	}
+	fmt.Printf("Request %d denied\n", id)
+	return nil
+}
+
+// maxPendingRequests and maxPendingRequestsPerUser bound the number of
+// requests for keys queued by the agent, since anyone can request keys.
+const (
+	maxPendingRequests        = 100
+	maxPendingRequestsPerUser = 3
+)
+
+// keyRequest is the request of a user for a key to a lock, as queued by the
+// agent of the user that is asked for it.
+type keyRequest struct {
+	ID   uint64
+	Lock string
+	User string
+	Time time.Time
+}
+
+type agentService struct {
+	env *cmdline.Env
+	mu  sync.Mutex // held while the invoker is prompted
+
+	requestsMu sync.Mutex
+	nextID     uint64                // GUARDED_BY(requestsMu)
+	requests   map[uint64]keyRequest // GUARDED_BY(requestsMu)
+}
+
+func (a *agentService) ApproveUnlock(ctx *context.T, call rpc.ServerCall, lockName string, blessings []string) (bool, error) {
+	// Only the lock itself can request approval, and only from the client
+	// that claimed it.
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	if !isOwner(ctx, lockName) || !isLock(lockName, remoteBlessingNames) {
+		return false, verror.New(verror.ErrNoAccess, ctx, remoteBlessingNames)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fmt.Printf("Lock %v was asked to unlock by %v\n", lockName, strings.Join(blessings, ", "))
+	text, err := readFromStdin(a.env, `Do you want to approve the unlock? (YES to approve)`)
+	if err != nil {
+		return false, verror.Convert(verror.ErrInternal, ctx, err)
+	}
+	if ctx.Err() != nil {
+		fmt.Println("The request has expired")
+		return false, ctx.Err()
+	}
+	approved := strings.ToUpper(text) == "YES"
+	if approved {
+		fmt.Println("Unlock approved")
+	} else {
+		fmt.Println("Unlock denied")
+	}
+	return approved, nil
+}
+
+// RequestKey queues the request of the caller for a key to the lock
+// lockName, and returns the ID of the request. It fails if the caller already
+// requested a key to the lock, or has too many pending requests.
+//
+// Requests are queued whether or not this client holds a key to the lock, so
+// that callers cannot tell which locks it holds keys to.
+func (a *agentService) RequestKey(ctx *context.T, call rpc.ServerCall, lockName string) (uint64, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	user := locklib.User(remoteBlessingNames...)
+	if user == "" {
+		return 0, verror.New(verror.ErrNoAccess, ctx, remoteBlessingNames)
+	}
+	if !isValidLockName(lockName) {
+		return 0, verror.New(verror.ErrBadArg, ctx, lockName)
+	}
+
+	a.requestsMu.Lock()
+	defer a.requestsMu.Unlock()
+	if len(a.requests) >= maxPendingRequests {
+		return 0, NewErrTooManyKeyRequests(ctx)
+	}
+	pending := 0
+	for _, r := range a.requests {
+		if r.User != user {
+			continue
+		}
+		if r.Lock == lockName {
+			return 0, verror.New(verror.ErrExist, ctx, fmt.Sprintf("request %d", r.ID))
+		}
+		pending++
+	}
+	if pending >= maxPendingRequestsPerUser {
+		return 0, NewErrTooManyKeyRequests(ctx)
+	}
+	a.nextID++
+	r := keyRequest{ID: a.nextID, Lock: lockName, User: user, Time: time.Now()}
+	a.requests[r.ID] = r
+	if _, err := keyForLock(ctx, lockName); err != nil {
+		fmt.Printf("User %v requested a key for lock %v, which this client holds no key to (request %d)\n", user, lockName, r.ID)
+	} else {
+		fmt.Printf("User %v requested a key for lock %v (request %d)\n", user, lockName, r.ID)
+	}
+	return r.ID, nil
+}
+
+// ListRequests returns the queued requests for keys, ordered by ID.
+func (a *agentService) ListRequests(ctx *context.T, call rpc.ServerCall) ([]keyRequest, error) {
+	if err := authorizeSelf(ctx, call); err != nil {
+		return nil, err
+	}
+	a.requestsMu.Lock()
+	defer a.requestsMu.Unlock()
+	var requests []keyRequest
+	for id := uint64(1); id <= a.nextID; id++ {
+		if r, ok := a.requests[id]; ok {
+			requests = append(requests, r)
+		}
+	}
+	return requests, nil
+}
+
+// ApproveRequest sends the key requested by the request with the provided ID
+// to the requesting user, extended with category and valid for expiry (or
+// forever if zero).
+func (a *agentService) ApproveRequest(ctx *context.T, call rpc.ServerCall, id uint64, category string, expiry time.Duration) error {
+	if err := authorizeSelf(ctx, call); err != nil {
+		return err
+	}
+	r, err := a.takeRequest(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := sendKey(ctx, r.Lock, r.User, category, expiry, -1); err != nil {
+		// Put the request back so that it can be approved again.
+		a.requestsMu.Lock()
+		a.requests[id] = r
+		a.requestsMu.Unlock()
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+	return nil
+}
+
+// DenyRequest discards the request with the provided ID and, if it can,
+// lets the requesting user know.
+func (a *agentService) DenyRequest(ctx *context.T, call rpc.ServerCall, id uint64) error {
+	if err := authorizeSelf(ctx, call); err != nil {
+		return err
+	}
+	r, err := a.takeRequest(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Denied the request of user %v for a key for lock %v\n", r.User, r.Lock)
+	// The requesting user may have given up waiting, so failing to notify
+	// it is not an error.
+	if err := v23.GetClient(ctx).Call(ctx, recvKeyObjName(r.User), "KeyDenied", []interface{}{r.Lock}, nil); err != nil {
+		fmt.Printf("Failed to notify user %v: %v\n", r.User, err)
+	}
+	return nil
+}
+
+func (a *agentService) takeRequest(ctx *context.T, id uint64) (keyRequest, error) {
+	a.requestsMu.Lock()
+	defer a.requestsMu.Unlock()
+	r, ok := a.requests[id]
+	if !ok {
+		return r, verror.New(verror.ErrNoExist, ctx, fmt.Sprintf("request %d", id))
+	}
+	delete(a.requests, id)
+	return r, nil
+}
+
+// authorizeSelf returns an error unless the caller has the same public key
+// as this client, i.e., is another command run by the same user.
+func authorizeSelf(ctx *context.T, call rpc.ServerCall) error {
+	local, remote := call.Security().LocalPrincipal().PublicKey(), call.Security().RemoteBlessings().PublicKey()
+	if remote == nil || fmt.Sprint(local) != fmt.Sprint(remote) {
+		remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+		return verror.New(verror.ErrNoAccess, ctx, remoteBlessingNames)
+	}
+	return nil
+}
+
+// isOwner returns true if this client holds the key obtained by claiming the
+// lock lockName, rather than a key sent by another user.
+func isOwner(ctx *context.T, lockName string) bool {
+	key, err := keyForLock(ctx, lockName)
+	if err != nil {
+		return false
+	}
+	for _, b := range security.BlessingNames(v23.GetPrincipal(ctx), key) {
+		if b == lockName+security.ChainSeparator+"key" {
+			return true
+		}
+	}
+	return false
+}
+
+func isLock(lockName string, remoteBlessingNames []string) bool {
+	for _, b := range remoteBlessingNames {
+		if b == lockName {
+			return true
+		}
+	}
+	return false
+}
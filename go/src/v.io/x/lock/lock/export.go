@@ -0,0 +1,164 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/vom"
+
+	"v.io/x/lib/cmdline"
+)
+
+func runPublicKey(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 0 {
+		return fmt.Errorf("requires no arguments, provided %d", numargs)
+	}
+	der, err := v23.GetPrincipal(ctx).PublicKey().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, base64.URLEncoding.EncodeToString(der))
+	return nil
+}
+
+func runExportKey(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <public key>, provided %d", numargs)
+	}
+	lockName := args[0]
+	if flagExportCategory == "" {
+		return fmt.Errorf("--category must be set")
+	}
+	der, err := base64.URLEncoding.DecodeString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid public key %q: %v", args[1], err)
+	}
+	publicKey, err := security.UnmarshalPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("invalid public key %q: %v", args[1], err)
+	}
+
+	key, err := keyForLock(ctx, lockName)
+	if err != nil {
+		return err
+	}
+	maxDepth := flagExportDepth
+	if flagExportNoDelegate {
+		maxDepth = 0
+	}
+	caveats, err := keyCaveats(lockName, flagExportFor, maxDepth)
+	if err != nil {
+		return err
+	}
+	exported, err := v23.GetPrincipal(ctx).Bless(publicKey, key, flagExportCategory, caveats[0], caveats[1:]...)
+	if err != nil {
+		return fmt.Errorf("failed to extend key %v: %v", key, err)
+	}
+	data, err := vom.Encode(exported)
+	if err != nil {
+		return fmt.Errorf("failed to encode key %v: %v", exported, err)
+	}
+	text := base64.URLEncoding.EncodeToString(data)
+
+	if flagExportOutput == "" {
+		fmt.Fprintln(env.Stdout, text)
+	} else if err := ioutil.WriteFile(flagExportOutput, []byte(text+"\n"), 0600); err != nil {
+		return err
+	} else {
+		fmt.Fprintf(env.Stdout, "Exported key %v to %v\n", exported, flagExportOutput)
+	}
+	if flagExportQR {
+		code, err := qr.Encode(text, qr.L)
+		if err != nil {
+			return fmt.Errorf("failed to encode key as a QR code: %v", err)
+		}
+		fmt.Fprint(env.Stdout, asciiQR(code))
+	}
+	return nil
+}
+
+func runImportKey(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one argument <file>, provided %d", numargs)
+	}
+	text, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := base64.URLEncoding.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return fmt.Errorf("failed to decode key in %v: %v", args[0], err)
+	}
+	// Decoding verifies the signatures of the key.
+	var key security.Blessings
+	if err := vom.Decode(data, &key); err != nil {
+		return fmt.Errorf("failed to decode key in %v: %v", args[0], err)
+	}
+
+	if got, want := fmt.Sprint(key.PublicKey()), fmt.Sprint(v23.GetPrincipal(ctx).PublicKey()); got != want {
+		return fmt.Errorf("key %v is for public key %v, not that of this client (%v)", key, got, want)
+	}
+	if exp := key.Expiry(); !exp.IsZero() && exp.Before(time.Now()) {
+		return fmt.Errorf("key %v expired at %v", key, exp.Format(time.RFC3339))
+	}
+	lockName, err := keyLockName(key)
+	if err != nil {
+		return err
+	}
+	if err := saveKeyForLock(ctx, key, lockName, "file "+args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "Imported key %v for lock %v\n", key, lockName)
+	return nil
+}
+
+// keyLockName returns the name of the lock that key is a key to, which must
+// be unique.
+func keyLockName(key security.Blessings) (string, error) {
+	var lockName string
+	for _, b := range strings.Split(key.String(), ",") {
+		name := strings.SplitN(b, security.ChainSeparator, 2)[0]
+		if !isValidLockName(name) || !claimsLock(key, name) {
+			continue
+		}
+		if lockName != "" && lockName != name {
+			return "", fmt.Errorf("key %v is a key to several locks", key)
+		}
+		lockName = name
+	}
+	if lockName == "" {
+		return "", fmt.Errorf("key %v is not a key to any lock", key)
+	}
+	return lockName, nil
+}
+
+// asciiQR renders code with "#" for black modules, surrounded by the quiet
+// zone that readers expect.
+func asciiQR(code *qr.Code) string {
+	const quiet = 4
+	var buf bytes.Buffer
+	for y := -quiet; y < code.Size+quiet; y++ {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			if code.Black(x, y) {
+				buf.WriteString("##")
+			} else {
+				buf.WriteString("  ")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -55,8 +55,26 @@ func keyForLock(ctx *context.T, lockName string) (security.Blessings, error) {
 	return ret, nil
 }
 
-func saveKeyForLock(ctx *context.T, key security.Blessings, lockName string) error {
-	if isKeyValidForLock(ctx, key, lockName) {
+// claimsLock returns true if key claims to be a key to the lock lockName.
+// Unlike isKeyValidForLock, it does not require the root of key to be
+// recognized, which it is not until a first key to the lock is saved.
+func claimsLock(key security.Blessings, lockName string) bool {
+	if key.IsZero() {
+		return false
+	}
+	bp := security.BlessingPattern(lockName + security.ChainSeparator + "key")
+	for _, b := range strings.Split(key.String(), ",") {
+		if bp.MatchedBy(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveKeyForLock saves key, obtained from from (see walletEntry.From), as the
+// key to the lock lockName, and records it in the wallet.
+func saveKeyForLock(ctx *context.T, key security.Blessings, lockName, from string) error {
+	if !claimsLock(key, lockName) {
 		return fmt.Errorf("key %v is not valid for lock %v", key, lockName)
 	}
 	p := v23.GetPrincipal(ctx)
@@ -66,6 +84,7 @@ func saveKeyForLock(ctx *context.T, key security.Blessings, lockName string) err
 	if err := security.AddToRoots(p, key); err != nil {
 		return fmt.Errorf("failed to save key %v for lock %v", key, lockName)
 	}
+	recordKey(key, lockName, from)
 	return nil
 }
 
@@ -5,10 +5,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,20 +26,35 @@ import (
 	"v.io/x/lib/cmdline"
 	"v.io/x/lock"
 	"v.io/x/lock/locklib"
+	"v.io/x/ref/lib/signals"
 	"v.io/x/ref/lib/v23cmd"
 	_ "v.io/x/ref/runtime/factories/roaming"
 )
 
 const (
 	// TODO(ataly): Define these conventions in the README
-	recvKeySuffix          = "recvkey"
-	lockUserNhPrefix       = "user-"
-	lockUserNhGlobPrefix   = "nh/user-"
-	vanadiumBlessingPrefix = "dev.v.io:u"
+	recvKeySuffix        = "recvkey"
+	lockUserNhGlobPrefix = "nh/" + locklib.UserNhPrefix
 )
 
 var (
 	flagSendKeyExpiry time.Duration
+	flagSendKeyDepth  int
+	flagNoDelegate    bool
+	flagApproveExpiry time.Duration
+	flagRecvKeyPolicy string
+	flagListKeysJSON  bool
+	flagListExpired   bool
+	flagPINFrom       string
+	flagPINFor        time.Duration
+	flagPermsVersion  string
+
+	flagExportFor        time.Duration
+	flagExportCategory   string
+	flagExportOutput     string
+	flagExportQR         bool
+	flagExportDepth      int
+	flagExportNoDelegate bool
 
 	lockNhGlobPrefix = path.Join("nh", locklib.LockNhPrefix)
 	cmdScan          = &cmdline.Command{
@@ -88,6 +106,10 @@ Locks the specified lock.
 		Short:  "Unlock the specified lock",
 		Long: `
 Unlocks the specified lock.
+
+If the lock is subject to the two-person rule, this merely requests the lock to
+be unlocked, which it is once another key holder also unlocks it shortly
+afterwards (See also: status).
 `,
 		ArgsName: "<lock>",
 		ArgsLong: `
@@ -99,7 +121,211 @@ Unlocks the specified lock.
 		Name:   "status",
 		Short:  "Print the current status of the specified lock",
 		Long: `
-Prints the current status of the specified lock.
+Prints the current status of the specified lock, along with the level of its
+battery and any unlock pending confirmation under the two-person rule, if
+applicable.
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdDiag = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runDiag),
+		Name:   "diag",
+		Short:  "Print diagnostics of the specified lock",
+		Long: `
+Prints information for troubleshooting the specified lock, such as the
+version and uptime of the lock service, the hardware in use and the last
+hardware error.
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdWatch = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runWatch),
+		Name:   "watch",
+		Short:  "Print changes of the state of the specified lock",
+		Long: `
+Prints a line for every change of the state of the specified lock, and for
+every alarm it raises, until interrupted. Each line is of the form
+<time> <status> <cause> [<blessings, PIN label or alarm>]
+where <cause> is "Remote" for changes made with a key, "Keypad" for changes
+made with a PIN, "Manual" for changes made by hand (or with a physical key),
+"Automatic" for locks that relock by themselves and "Alarm" for alarms, which
+are followed by their kind and ID (see lock alarms).
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdAlarms = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runAlarms),
+		Name:   "alarms",
+		Short:  "List the alarms raised by the specified lock",
+		Long: `
+Lists the alarms raised by the specified lock when its enclosure was opened
+or it was forced open, most recent first.
+
+Each line of the list is of the form
+<id> <time> <kind> [acknowledged]
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdAckAlarm = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runAckAlarm),
+		Name:   "ackalarm",
+		Short:  "Acknowledge an alarm raised by the specified lock",
+		Long: `
+Marks an alarm raised by the specified lock as acknowledged (See also: alarms).
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock> <id>",
+		ArgsLong: `
+<lock> is the name of the lock.
+<id> is the ID of the alarm, as listed by the alarms command.
+`,
+	}
+	cmdLockouts = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runLockouts),
+		Name:   "lockouts",
+		Short:  "List the callers locked out of the specified lock",
+		Long: `
+Lists the callers that are temporarily refused access to the specified lock
+after too many failed attempts to claim, lock or unlock it, the lockouts that
+end first first.
+
+Each line of the list is of the form
+<until> <key> <blessings>
+where <key> is the public key of the caller and <blessings> are the blessings
+it presented in its most recent failed attempt. The keypad of the lock, locked
+out after too many wrong PINs, is listed with the key "keypad".
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdHolders = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runHolders),
+		Name:   "holders",
+		Short:  "List the key holders that have used the specified lock",
+		Long: `
+Lists the distinct blessings with which key holders have called the specified
+lock, most recently seen first, so that stale keys can be found and revoked.
+
+Each line of the list is of the form
+<last seen> <first seen> <uses> <blessings>
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdPerms = &cmdline.Command{
+		Name:  "perms",
+		Short: "Get or set the permissions of the specified lock",
+		Long: `
+Gets or sets the permissions that authorize calls to the specified lock.
+
+Each method of a lock is tagged Read, Write or Admin: Lock and Unlock are
+tagged Write, the methods that report on the lock (such as Status) are tagged
+Read, and the administrative methods (such as AddPIN and SetPermissions) are
+tagged Admin. A caller is authorized to call a method if its blessings are
+granted the method's tag by the permissions of the lock.
+
+By default, the permissions grant Read and Write to all key holders and Admin
+to the principal that claimed the lock. Permissions that do not grant Admin to
+that principal are refused, so that it cannot lose control of the lock.
+`,
+		Children: []*cmdline.Command{cmdPermsGet, cmdPermsSet},
+	}
+	cmdPermsGet = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runPermsGet),
+		Name:   "get",
+		Short:  "Print the permissions of the specified lock",
+		Long: `
+Prints the permissions of the specified lock as JSON, and their version to
+standard error.
+`,
+		ArgsName: "<lock>",
+		ArgsLong: `
+<lock> is the name of the lock.
+`,
+	}
+	cmdPermsSet = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runPermsSet),
+		Name:   "set",
+		Short:  "Set the permissions of the specified lock",
+		Long: `
+Replaces the permissions of the specified lock with those read, as JSON, from
+the specified file, as printed by "lock perms get".
+`,
+		ArgsName: "<lock> <file>",
+		ArgsLong: `
+<lock> is the name of the lock.
+
+<file> is the file to read the permissions from, or "-" for standard input.
+`,
+	}
+	cmdAddPIN = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runAddPIN),
+		Name:   "addpin",
+		Short:  "Add a PIN to the specified lock",
+		Long: `
+Adds a PIN, read from the standard input, that unlocks the specified lock
+when entered on its keypad. This allows guests without keys to be let in.
+
+The PIN can be restricted to a period of time via the --from and --for flags.
+
+Requires Admin access (see lock perms).
+`,
+		ArgsName: "<lock> <label>",
+		ArgsLong: `
+<lock> is the name of the lock.
+<label> identifies the PIN, for example, "cleaner" or "guest".
+`,
+	}
+	cmdRemovePIN = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runRemovePIN),
+		Name:   "removepin",
+		Short:  "Remove a PIN from the specified lock",
+		Long: `
+Removes a PIN previously added to the specified lock (See also: addpin).
+`,
+		ArgsName: "<lock> <label>",
+		ArgsLong: `
+<lock> is the name of the lock.
+<label> identifies the PIN.
+`,
+	}
+	cmdListPINs = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runListPINs),
+		Name:   "listpins",
+		Short:  "List the PINs of the specified lock",
+		Long: `
+Lists the labels of the PINs of the specified lock and the periods during
+which they are valid. The PINs themselves cannot be listed.
+
+Each line of the list is of the form
+<label> <valid from> <valid until>
 `,
 		ArgsName: "<lock>",
 		ArgsLong: `
@@ -114,11 +340,22 @@ Prints the current status of the specified lock.
 Lists the set of available physical-lock keys and the names of the locks
 to which they apply.
 
-Each line of the list is of the form
-<lock> <key>
+Each key is listed on a line of the form
+<lock> <key> (Expires: <expiry time>)
+followed by lines stating from whom and when the key was obtained, under
+which category, and with which caveats. Keys obtained before this was
+recorded only list their category and caveats.
 
-TODO(ataly, ashankar): Also print additional information such as when and
-from whom was the key obtained.
+Expired keys are only listed with --expired, and can be removed with the
+prunekeys command. With --json, the keys are listed as a JSON array instead.
+`,
+	}
+	cmdPruneKeys = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runPruneKeys),
+		Name:   "prunekeys",
+		Short:  "Remove expired keys",
+		Long: `
+Removes the expired keys listed by listkeys --expired from this client.
 `,
 	}
 	cmdRecvKey = &cmdline.Command{
@@ -137,6 +374,99 @@ permission to save the key.
 If permission is granted then the key is saved and the process returns,
 otherwise the key is discarded and the command continues to wait for other
 keys.
+
+With --policy, the command runs until it is interrupted, for instance on
+headless clients. It saves the keys accepted by the policy file without
+asking for permission, and prints the keys it rejects along with the reason.
+The policy file is a JSON object listing rules, each of which accepts the keys
+to any of its locks sent by any of its senders (where "*" matches any lock or
+sender) that expire within its maximum duration, if set:
+
+{
+  "Rules": [
+    {"Senders": ["alice@gmail.com"], "Locks": ["front-door"], "MaxDuration": "24h"}
+  ]
+}
+`,
+	}
+	cmdAgent = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runAgent),
+		Name:   "agent",
+		Short:  "Act on behalf of this client for other users and locks",
+		Long: `
+Runs an agent on behalf of this client, which other users and the locks
+claimed by this client can reach in the neighborhood while it runs.
+
+The agent queues the requests of other users for keys to locks (See also:
+request), until they are approved or denied with the requests, approve and
+deny commands.
+
+The agent also asks the invoker to approve or deny the unlock of locks
+claimed by this client by keys whose category requires it (see
+Hardware.Approval in the lockd.conf file of the lock). Locks deny the unlocks
+that are not approved in time.
+
+The command runs until it is interrupted. Requests for keys that are still
+queued are then lost.
+`,
+	}
+	cmdRequest = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runRequest),
+		Name:   "request",
+		Short:  "Request a key to the specified lock from another user",
+		Long: `
+Requests a key to the specified lock from another user, whose agent queues the
+request until the user approves or denies it (See also: agent).
+
+The command then waits for the key, which is saved without asking for
+confirmation, or for the request to be denied. If it is interrupted, the key
+can still be received later with the recvkey command.
+`,
+		ArgsName: "<lock> <user>",
+		ArgsLong: `
+<lock> is the name of the lock.
+<user> is the name of the user who holds a key to the lock, as listed by the
+users command.
+`,
+	}
+	cmdRequests = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runRequests),
+		Name:   "requests",
+		Short:  "List the requests of other users for keys",
+		Long: `
+Lists the requests of other users for keys to locks, as queued by the agent of
+this client.
+
+Each line of the list is of the form
+<id> <time> <lock> <user>
+`,
+	}
+	cmdApprove = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runApprove),
+		Name:   "approve",
+		Short:  "Approve a request for a key",
+		Long: `
+Approves a request for a key queued by the agent of this client, which sends
+the key to the requesting user, as the sendkey command does.
+
+The validity of the key can be restricted via the --for flag.
+`,
+		ArgsName: "<id> <category>",
+		ArgsLong: `
+<id> is the ID of the request, as listed by the requests command.
+<category> is the category under which the key is sent, as with sendkey.
+`,
+	}
+	cmdDeny = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runDeny),
+		Name:   "deny",
+		Short:  "Deny a request for a key",
+		Long: `
+Denies a request for a key queued by the agent of this client.
+`,
+		ArgsName: "<id>",
+		ArgsLong: `
+<id> is the ID of the request, as listed by the requests command.
 `,
 	}
 	cmdSendKey = &cmdline.Command{
@@ -148,6 +478,11 @@ Allows this client to send a physical-lock key to another physical-lock user
 present in the neighbordhood (See also: users).
 
 An expiration time can be set on the key via the --for flag.
+
+The number of times that the key can be further extended, by the user and by
+those the user extends it to, can be limited via the --max-depth flag, and
+--no-delegate prevents the user from extending it at all. The lock refuses the
+keys extended beyond this limit.
 `,
 		ArgsName: "<lock> <user> <category>",
 		ArgsLong: `
@@ -155,6 +490,56 @@ An expiration time can be set on the key via the --for flag.
 <user> is the physical-lock user to whom the key must be sent, and
 <category> is how you'd like to classify the user (e.g., "friend",
 "spouse", "colleague", etc.)
+`,
+	}
+	cmdPublicKey = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runPublicKey),
+		Name:   "publickey",
+		Short:  "Print the public key of this client",
+		Long: `
+Prints the public key of this client, in the form expected by exportkey.
+`,
+	}
+	cmdExportKey = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runExportKey),
+		Name:   "exportkey",
+		Short:  "Export a key for another user to import offline",
+		Long: `
+Extends the key of this client to the specified lock for the user with the
+specified public key, and writes it to the file specified via the -o flag (or
+to the standard output), for the user to import with the importkey command.
+Unlike sendkey, this does not require the user to be in the neighborhood.
+
+The category of the key must be set via the --category flag, and an
+expiration time can be set on the key via the --for flag. With --qr, the key
+is also printed as a QR code.
+
+As with sendkey, the number of times that the key can be further extended can
+be limited via the --max-depth flag, and --no-delegate prevents the user from
+extending it at all.
+
+Anyone with the exported key can only use it with the private key of the
+user, but the key should still be kept from others.
+`,
+		ArgsName: "<lock> <public key>",
+		ArgsLong: `
+<lock> is the name of the lock whose key must be exported.
+<public key> is the public key of the user, as printed by the publickey
+command run by the user.
+`,
+	}
+	cmdImportKey = &cmdline.Command{
+		Runner: v23cmd.RunnerFunc(runImportKey),
+		Name:   "importkey",
+		Short:  "Import a key exported by another user",
+		Long: `
+Imports a key exported for this client by another user with the exportkey
+command, after verifying that the key is for the public key of this client,
+that it has not expired and that it is a key to a lock.
+`,
+		ArgsName: "<file>",
+		ArgsLong: `
+<file> is the file that the key was exported to.
 `,
 	}
 )
@@ -258,6 +643,7 @@ func runClaim(ctx *context.T, env *cmdline.Env, args []string) error {
 	if _, err := p.BlessingStore().Set(b, security.BlessingPattern(name)); err != nil {
 		return fmt.Errorf("failed to set (key) blessing (%v) for peer %v: %v", b, name, err)
 	}
+	recordKey(b, name, "")
 	fmt.Printf("Claimed lock: %v as %v and received key: %v\n", lockName, name, b)
 	return nil
 }
@@ -311,40 +697,349 @@ func runStatus(ctx *context.T, env *cmdline.Env, args []string) error {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
-	status, err := lock.LockClient(lockObjName(lockName)).Status(ctx)
+	client := lock.LockClient(lockObjName(lockName))
+	status, err := client.Status(ctx)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("lock %v is: %v\n", lockName, status)
+	level, err := client.BatteryLevel(ctx)
+	switch {
+	case err == nil:
+		fmt.Printf("battery: %.0f%%\n", level*100)
+	case verror.ErrorID(err) == verror.ErrNoExist.ID, verror.ErrorID(err) == verror.ErrUnknownMethod.ID:
+		// The lock cannot sense its battery, or is too old to say.
+	default:
+		return err
+	}
+	pending, err := client.PendingUnlock(ctx)
+	switch {
+	case err == nil:
+		fmt.Printf("unlock requested by %q at %v, pending until %v\n", pending.Blessings, pending.Time.Format(time.RFC3339), pending.Expires.Format(time.RFC3339))
+	case verror.ErrorID(err) == verror.ErrNoExist.ID, verror.ErrorID(err) == verror.ErrUnknownMethod.ID:
+		// There is no pending unlock, or the lock is too old to say.
+	default:
+		return err
+	}
 	return nil
 }
 
-func runListKeys(ctx *context.T, env *cmdline.Env, args []string) error {
-	peerBlessings := v23.GetPrincipal(ctx).BlessingStore().PeerBlessings()
-	const format = "%-30s   %s (Expires: %s)\n"
+func runDiag(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
 
-	fmt.Printf(format, "Lock", "Key", "<expiry time>")
-	for lock, key := range peerBlessings {
-		if !isValidLockName(string(lock)) {
-			continue
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	d, err := lock.LockAdminClient(lockAdminObjName(lockName)).Diagnostics(ctx)
+	if err != nil {
+		return err
+	}
+	const format = "%-20s %v\n"
+	fmt.Printf(format, "Version:", d.Version)
+	fmt.Printf(format, "Uptime:", d.Uptime)
+	fmt.Printf(format, "Hardware:", d.Hardware)
+	pins := make([]string, 0, len(d.Pins))
+	for function, pin := range d.Pins {
+		pins = append(pins, fmt.Sprintf("%v=%v", function, pin))
+	}
+	sort.Strings(pins)
+	fmt.Printf(format, "GPIO pins:", strings.Join(pins, " "))
+	if len(d.LastHardwareError) == 0 {
+		fmt.Printf(format, "Last hardware error:", "none")
+	} else {
+		fmt.Printf(format, "Last hardware error:", fmt.Sprintf("%v (at %v)", d.LastHardwareError, d.LastHardwareErrorTime))
+	}
+	fmt.Printf(format, "Actuations:", d.Actuations)
+	fmt.Printf(format, "Config dir usage:", fmt.Sprintf("%d bytes", d.ConfigDirBytes))
+	fmt.Printf(format, "Neighborhood name:", d.NeighborhoodName)
+	if d.BatteryLevel < 0 {
+		fmt.Printf(format, "Battery:", "unknown")
+	} else {
+		fmt.Printf(format, "Battery:", fmt.Sprintf("%.0f%%", d.BatteryLevel*100))
+	}
+	return nil
+}
+
+func runWatch(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	call, err := lock.LockAdminClient(lockAdminObjName(lockName)).Watch(ctx)
+	if err != nil {
+		return err
+	}
+	stream := call.RecvStream()
+	for stream.Advance() {
+		e := stream.Value()
+		var by string
+		switch e.Cause {
+		case lock.LockEventCauseRemote:
+			by = fmt.Sprint(e.Blessings)
+		case lock.LockEventCauseKeypad:
+			by = fmt.Sprintf("%q", e.PIN)
+		case lock.LockEventCauseAlarm:
+			by = fmt.Sprintf("%v %d", e.Alarm.Kind, e.Alarm.ID)
 		}
-		if !isKeyValidForLock(ctx, key, string(lock)) {
-			continue
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%v %v %v %v", e.Time.Format(time.RFC3339), e.Status, e.Cause, by)))
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return call.Finish()
+}
+
+func runAlarms(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	alarms, err := lock.LockClient(lockObjName(lockName)).Alarms(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range alarms {
+		line := fmt.Sprintf("%d %v %v", a.ID, a.Time.Format(time.RFC3339), a.Kind)
+		if a.Acknowledged {
+			line += " acknowledged"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func runAckAlarm(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <id>, provided %d", numargs)
+	}
+	lockName := args[0]
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid alarm ID %q: %v", args[1], err)
+	}
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := lock.LockAdminClient(lockAdminObjName(lockName)).AcknowledgeAlarm(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("Acknowledged alarm %d of lock %v\n", id, lockName)
+	return nil
+}
+
+func runLockouts(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	lockouts, err := lock.LockAdminClient(lockAdminObjName(lockName)).Lockouts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range lockouts {
+		fmt.Printf("%v %v %q\n", l.Until.Format(time.RFC3339), l.Key, l.Blessings)
+	}
+	return nil
+}
+
+func runHolders(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	holders, err := lock.LockAdminClient(lockAdminObjName(lockName)).ListKeyHolders(ctx)
+	if err != nil {
+		return err
+	}
+	for _, h := range holders {
+		fmt.Printf("%v %v %d %q\n", h.LastSeen.Format(time.RFC3339), h.FirstSeen.Format(time.RFC3339), h.Uses, h.Blessings)
+	}
+	return nil
+}
+
+func runAddPIN(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <label>, provided %d", numargs)
+	}
+	lockName, label := args[0], args[1]
+
+	info := lock.PINInfo{Label: label}
+	start := time.Now()
+	if len(flagPINFrom) > 0 {
+		var err error
+		if start, err = time.Parse(time.RFC3339, flagPINFrom); err != nil {
+			return fmt.Errorf("invalid --from=%v, must be of the form %v: %v", flagPINFrom, time.RFC3339, err)
+		}
+		info.NotBefore = start
+	}
+	if flagPINFor != 0 {
+		info.NotAfter = start.Add(flagPINFor)
+	}
+	pin, err := readFromStdin(env, "Enter the PIN:")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := lock.LockAdminClient(lockAdminObjName(lockName)).AddPIN(ctx, strings.TrimSpace(pin), info); err != nil {
+		return err
+	}
+	fmt.Printf("Added PIN %q to lock %v\n", label, lockName)
+	return nil
+}
+
+func runRemovePIN(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <label>, provided %d", numargs)
+	}
+	lockName, label := args[0], args[1]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := lock.LockAdminClient(lockAdminObjName(lockName)).RemovePIN(ctx, label); err != nil {
+		return err
+	}
+	fmt.Printf("Removed PIN %q from lock %v\n", label, lockName)
+	return nil
+}
+
+func runListPINs(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one arguments <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	pins, err := lock.LockAdminClient(lockAdminObjName(lockName)).ListPINs(ctx)
+	if err != nil {
+		return err
+	}
+	bound := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
 		}
-		var (
-			expiresIn string
-			now       = time.Now()
-		)
-		if exp := key.Expiry(); !exp.IsZero() && exp.Before(now) {
-			// TODO(ataly): Remove the key from the blessing
-			// store.
-			continue
-		} else if exp.IsZero() {
+		return t.Format(time.RFC3339)
+	}
+	for _, p := range pins {
+		fmt.Printf("%v %v %v\n", p.Label, bound(p.NotBefore), bound(p.NotAfter))
+	}
+	return nil
+}
+
+func runListKeys(ctx *context.T, env *cmdline.Env, args []string) error {
+	all, err := walletKeys(ctx)
+	if err != nil {
+		return err
+	}
+	var keys []walletKey
+	for _, k := range all {
+		// Expired keys are removed by prunekeys.
+		if !k.Expired || flagListExpired {
+			keys = append(keys, k)
+		}
+	}
+	if flagListKeysJSON {
+		data, err := json.MarshalIndent(keys, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Stdout, string(data))
+		return nil
+	}
+
+	const format = "%-30s   %s (Expires: %s)\n"
+	fmt.Printf(format, "Lock", "Key", "<expiry time>")
+	now := time.Now()
+	for _, k := range keys {
+		var expiresIn string
+		if k.Expiry.IsZero() {
 			expiresIn = "NEVER"
+		} else if k.Expired {
+			expiresIn = fmt.Sprintf("EXPIRED at %v", k.Expiry.Format(time.RFC3339))
 		} else {
-			expiresIn = fmt.Sprintf("in %v", exp.Sub(now))
+			expiresIn = fmt.Sprintf("in %v", k.Expiry.Sub(now))
+		}
+		fmt.Printf(format, k.Lock, k.Key, expiresIn)
+		switch {
+		case !k.Received.IsZero() && k.From == "":
+			fmt.Printf("    Obtained by claiming the lock on %v\n", k.Received.Format(time.RFC3339))
+		case !k.Received.IsZero():
+			fmt.Printf("    Received from %v on %v\n", k.From, k.Received.Format(time.RFC3339))
+		}
+		if k.Category != "" {
+			fmt.Printf("    Category: %v\n", k.Category)
+		}
+		if len(k.Caveats) > 0 {
+			fmt.Printf("    Caveats: %v\n", strings.Join(k.Caveats, ", "))
 		}
-		fmt.Printf(format, lock, key, expiresIn)
 	}
 	return nil
 }
@@ -360,6 +1055,11 @@ func runRecvKey(ctx *context.T, env *cmdline.Env, args []string) error {
 		env:    env,
 		notify: make(chan error),
 	}
+	if flagRecvKeyPolicy != "" {
+		if service.policy, err = loadRecvKeyPolicy(flagRecvKeyPolicy); err != nil {
+			return err
+		}
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	_, server, err := v23.WithNewServer(ctx, recvKeySuffix, service, security.AllowEveryone())
 	if err != nil {
@@ -370,6 +1070,10 @@ func runRecvKey(ctx *context.T, env *cmdline.Env, args []string) error {
 		<-server.Closed()
 	}()
 	fmt.Println("Waiting for keys")
+	if service.policy != nil {
+		<-signals.ShutdownOnSignals(ctx)
+		return nil
+	}
 	return <-service.notify
 }
 
@@ -385,6 +1089,17 @@ func runSendKey(ctx *context.T, env *cmdline.Env, args []string) error {
 	}
 	defer stop()
 
+	maxDepth := flagSendKeyDepth
+	if flagNoDelegate {
+		maxDepth = 0
+	}
+	return sendKey(ctx, lockName, user, category, flagSendKeyExpiry, maxDepth)
+}
+
+// sendKey sends an extension of this client's key to the lock lockName,
+// valid for expiry (or forever if zero) and further extensible maxDepth times
+// (or without limit if negative), to the recvkey service of user.
+func sendKey(ctx *context.T, lockName, user, category string, expiry time.Duration, maxDepth int) error {
 	key, err := keyForLock(ctx, lockName)
 	if err != nil {
 		return err
@@ -392,7 +1107,7 @@ func runSendKey(ctx *context.T, env *cmdline.Env, args []string) error {
 
 	fmt.Printf("Sending key %v (extended with %v) to user %v\n", key, category, user)
 	client := v23.GetClient(ctx)
-	granter := &granter{lockName: lockName, key: key, category: category, expiry: flagSendKeyExpiry, user: user}
+	granter := &granter{lockName: lockName, key: key, category: category, expiry: expiry, maxDepth: maxDepth, user: user}
 	if err := client.Call(ctx, recvKeyObjName(user), "Grant", []interface{}{lockName}, nil, granter); err != nil {
 		return fmt.Errorf("failed to send key to %q: %v", user, err)
 	}
@@ -427,51 +1142,54 @@ func withLocalNamespace(ctx *context.T, mtName, nhName string) (*context.T, func
 
 }
 
-// vUser returns a comma-separated string of user identities obtained
-// from the provided blessing names.
-//
-// For each blessing name, vUser checks if it matches the pattern
-// 'vanadiumBlessingPrefix' and if so constructs the user identity by
-// stripping off 'vanadiumBlessingPrefix' from the blessing name.
-// Otherwise the user identity is simply the blessing name.
-//
-// In all case, the user identity is converted into a valid neighborhood-name
-// by replacing slahes with "@@".
-// TODO(ataly): Try to use conventions.GetClientUserIds instead.
-func vUser(bNames ...string) string {
-	nhFriendly := func(b string) string {
-		return strings.Replace(b, security.ChainSeparator, "@@", -1)
-	}
-	users := make([]string, len(bNames))
-	for i, b := range bNames {
-		if !security.BlessingPattern(vanadiumBlessingPrefix).MatchedBy(b) {
-			users[i] = nhFriendly(b)
-			continue
-		}
-		users[i] = nhFriendly(strings.TrimPrefix(b, vanadiumBlessingPrefix+security.ChainSeparator))
-	}
-	return strings.Join(users, ",")
+func lockUserNhName(ctx *context.T) string {
+	return locklib.UserNhPrefix + localUser(ctx)
 }
 
-func lockUserNhName(ctx *context.T) string {
+// localUser returns the name of the user of this client, as seen by other
+// users (see locklib.User).
+func localUser(ctx *context.T) string {
 	var (
 		principal    = v23.GetPrincipal(ctx)
 		blessings, _ = principal.BlessingStore().Default()
 		bNames       = security.BlessingNames(principal, blessings)
 	)
-	return lockUserNhPrefix + vUser(bNames...)
+	return locklib.User(bNames...)
 }
 
 func recvKeyObjName(user string) string {
 	return path.Join(lockUserNhGlobPrefix+user, recvKeySuffix)
 }
 
+func agentObjName(user string) string {
+	return path.Join(lockUserNhGlobPrefix+user, locklib.AgentSuffix)
+}
+
 func lockObjName(lockName string) string {
 	return path.Join(lockNhGlobPrefix+lockName, locklib.LockSuffix)
 }
 
+func lockAdminObjName(lockName string) string {
+	return path.Join(lockObjName(lockName), locklib.AdminSuffix)
+}
+
 func main() {
+	cmdListKeys.Flags.BoolVar(&flagListKeysJSON, "json", false, "List the keys as a JSON array")
+	cmdListKeys.Flags.BoolVar(&flagListExpired, "expired", false, "Also list expired keys")
+	cmdRecvKey.Flags.StringVar(&flagRecvKeyPolicy, "policy", "", "Path of the policy file that determines the keys to accept without confirmation (empty implies asking for each key)")
 	cmdSendKey.Flags.DurationVar(&flagSendKeyExpiry, "for", 0, "Duration of key validity (zero implies no expiration)")
+	cmdSendKey.Flags.IntVar(&flagSendKeyDepth, "max-depth", -1, "Maximum number of times the key can be further extended (negative implies no limit)")
+	cmdSendKey.Flags.BoolVar(&flagNoDelegate, "no-delegate", false, "Prevent the key from being further extended, as --max-depth=0 does")
+	cmdExportKey.Flags.DurationVar(&flagExportFor, "for", 0, "Duration of key validity (zero implies no expiration)")
+	cmdExportKey.Flags.StringVar(&flagExportCategory, "category", "", "Category under which the key is extended (e.g., \"guest\")")
+	cmdExportKey.Flags.StringVar(&flagExportOutput, "o", "", "Path of the file to write the key to (empty implies the standard output)")
+	cmdExportKey.Flags.BoolVar(&flagExportQR, "qr", false, "Also print the key as a QR code")
+	cmdExportKey.Flags.IntVar(&flagExportDepth, "max-depth", -1, "Maximum number of times the key can be further extended (negative implies no limit)")
+	cmdExportKey.Flags.BoolVar(&flagExportNoDelegate, "no-delegate", false, "Prevent the key from being further extended, as --max-depth=0 does")
+	cmdApprove.Flags.DurationVar(&flagApproveExpiry, "for", 0, "Duration of key validity (zero implies no expiration)")
+	cmdAddPIN.Flags.StringVar(&flagPINFrom, "from", "", "Time, in RFC3339 format, from which the PIN is valid (empty implies immediately)")
+	cmdPermsSet.Flags.StringVar(&flagPermsVersion, "version", "", "Version of the permissions being replaced, as printed by perms get (empty implies any version)")
+	cmdAddPIN.Flags.DurationVar(&flagPINFor, "for", 0, "Duration of PIN validity (zero implies no expiration)")
 	cmdline.HideGlobalFlagsExcept()
 	root := &cmdline.Command{
 		Name:  "lock",
@@ -479,7 +1197,7 @@ func main() {
 		Long: `
 Command lock claims and manages lock devices.
 `,
-		Children: []*cmdline.Command{cmdScan, cmdUsers, cmdClaim, cmdLock, cmdUnlock, cmdStatus, cmdListKeys, cmdRecvKey, cmdSendKey},
+		Children: []*cmdline.Command{cmdScan, cmdUsers, cmdClaim, cmdLock, cmdUnlock, cmdStatus, cmdDiag, cmdWatch, cmdAlarms, cmdAckAlarm, cmdLockouts, cmdHolders, cmdPerms, cmdAddPIN, cmdRemovePIN, cmdListPINs, cmdListKeys, cmdPruneKeys, cmdRecvKey, cmdSendKey, cmdPublicKey, cmdExportKey, cmdImportKey, cmdAgent, cmdRequest, cmdRequests, cmdApprove, cmdDeny},
 	}
 	cmdline.Main(root)
 }
@@ -488,6 +1206,14 @@ type recvKeyService struct {
 	principal security.Principal
 	env       *cmdline.Env
 	notify    chan error
+	// lockName and sender, if set, are those of a key requested by this
+	// client (see runRequest), which is saved without confirmation.
+	lockName string
+	sender   string
+	// policy, if set, determines the keys that are saved without
+	// confirmation, and the others are rejected. Saved keys are then not
+	// sent on notify.
+	policy *recvKeyPolicy
 }
 
 func (r *recvKeyService) confirmRecvKey() bool {
@@ -502,24 +1228,49 @@ func (r *recvKeyService) Grant(ctx *context.T, call rpc.ServerCall, lockName str
 	key := call.GrantedBlessings()
 	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
 
-	fmt.Printf("Received key %v for lock %v from user %v\n", key, lockName, vUser(remoteBlessingNames...))
-	if !r.confirmRecvKey() {
+	sender := locklib.User(remoteBlessingNames...)
+	fmt.Printf("Received key %v for lock %v from user %v\n", key, lockName, sender)
+	if r.policy != nil {
+		if err := r.policy.accept(lockName, sender, key); err != nil {
+			fmt.Printf("Rejected key %v for lock %v from user %v: %v\n", key, lockName, sender, err)
+			return NewErrKeyRejected(ctx, fmt.Sprintf("%v", key), lockName)
+		}
+	} else if !r.requested(lockName, sender) && !r.confirmRecvKey() {
 		return NewErrKeyRejected(ctx, fmt.Sprintf("%v", key), lockName)
 	}
 
-	if err := saveKeyForLock(ctx, key, lockName); err != nil {
+	if err := saveKeyForLock(ctx, key, lockName, sender); err != nil {
 		return verror.Convert(verror.ErrInternal, ctx, err)
 	}
 	fmt.Println("Key successfully saved")
-	r.notify <- nil
+	if r.policy == nil {
+		r.notify <- nil
+	}
+	return nil
+}
+
+// KeyDenied is invoked by the agent of a user (see agentService) when the
+// user denies the request of this client for a key to the lock lockName.
+func (r *recvKeyService) KeyDenied(ctx *context.T, call rpc.ServerCall, lockName string) error {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	sender := locklib.User(remoteBlessingNames...)
+	if !r.requested(lockName, sender) {
+		return verror.New(verror.ErrNoAccess, ctx, remoteBlessingNames)
+	}
+	r.notify <- NewErrKeyRequestDenied(ctx, lockName, sender)
 	return nil
 }
 
+func (r *recvKeyService) requested(lockName, sender string) bool {
+	return r.lockName != "" && r.lockName == lockName && r.sender == sender
+}
+
 type granter struct {
 	lockName string
 	key      security.Blessings
 	category string
 	expiry   time.Duration
+	maxDepth int
 	user     string
 }
 
@@ -529,7 +1280,7 @@ func (g *granter) Grant(ctx *context.T, call security.Call) (security.Blessings,
 	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call)
 	authorized := false
 	for _, b := range remoteBlessingNames {
-		if vUser(b) == g.user {
+		if locklib.User(b) == g.user {
 			authorized = true
 		}
 	}
@@ -537,21 +1288,39 @@ func (g *granter) Grant(ctx *context.T, call security.Call) (security.Blessings,
 		return security.Blessings{}, fmt.Errorf("remote end presented blessings %v, want a blessing for user %v", remoteBlessingNames, g.user)
 	}
 
-	peerPattern := security.BlessingPattern(g.lockName)
+	caveats, err := keyCaveats(g.lockName, g.expiry, g.maxDepth)
+	if err != nil {
+		return security.Blessings{}, err
+	}
+	return call.LocalPrincipal().Bless(call.RemoteBlessings().PublicKey(), g.key, g.category, caveats[0], caveats[1:]...)
+}
+
+// keyCaveats returns the caveats of a key extended for another user, which
+// restrict it to the lock lockName, unless expiry is zero to expiry from now,
+// and unless maxDepth is negative to maxDepth further extensions.
+func keyCaveats(lockName string, expiry time.Duration, maxDepth int) ([]security.Caveat, error) {
+	peerPattern := security.BlessingPattern(lockName)
 	onlyThisLockCav, err := security.NewCaveat(security.PeerBlessingsCaveat, []security.BlessingPattern{peerPattern})
 	if err != nil {
-		return security.Blessings{}, fmt.Errorf("failed to create peer blessings caveat for key: %v", err)
+		return nil, fmt.Errorf("failed to create peer blessings caveat for key: %v", err)
 	}
 
 	caveats := []security.Caveat{onlyThisLockCav}
-	if g.expiry != 0 {
-		expiryCav, err := security.NewExpiryCaveat(time.Now().Add(g.expiry))
+	if expiry != 0 {
+		expiryCav, err := security.NewExpiryCaveat(time.Now().Add(expiry))
 		if err != nil {
-			return security.Blessings{}, fmt.Errorf("failed to create expiration caveat for key: %v", err)
+			return nil, fmt.Errorf("failed to create expiration caveat for key: %v", err)
 		}
 		caveats = append(caveats, expiryCav)
 	}
-	return call.LocalPrincipal().Bless(call.RemoteBlessings().PublicKey(), g.key, g.category, caveats[0], caveats[1:]...)
+	if maxDepth >= 0 {
+		depthCav, err := security.NewCaveat(lock.MaxDepthCaveat, uint32(maxDepth))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create maximum depth caveat for key: %v", err)
+		}
+		caveats = append(caveats, depthCav)
+	}
+	return caveats, nil
 }
 
 func (*granter) RPCCallOpt() {}
@@ -19,7 +19,9 @@ var _ = __VDLInit() // Must be first; see __VDLInit comments for details.
 // Error definitions
 
 var (
-	ErrKeyRejected = verror.Register("v.io/x/lock/lock.KeyRejected", verror.NoRetry, "{1:}{2:} receiver rejected key {3} for lock {4}")
+	ErrKeyRejected        = verror.Register("v.io/x/lock/lock.KeyRejected", verror.NoRetry, "{1:}{2:} receiver rejected key {3} for lock {4}")
+	ErrKeyRequestDenied   = verror.Register("v.io/x/lock/lock.KeyRequestDenied", verror.NoRetry, "{1:}{2:} user {4} denied the request for a key to lock {3}")
+	ErrTooManyKeyRequests = verror.Register("v.io/x/lock/lock.TooManyKeyRequests", verror.RetryBackoff, "{1:}{2:} too many pending requests for keys")
 )
 
 // NewErrKeyRejected returns an error with the ErrKeyRejected ID.
@@ -27,6 +29,16 @@ func NewErrKeyRejected(ctx *context.T, key string, lock string) error {
 	return verror.New(ErrKeyRejected, ctx, key, lock)
 }
 
+// NewErrKeyRequestDenied returns an error with the ErrKeyRequestDenied ID.
+func NewErrKeyRequestDenied(ctx *context.T, lock string, user string) error {
+	return verror.New(ErrKeyRequestDenied, ctx, lock, user)
+}
+
+// NewErrTooManyKeyRequests returns an error with the ErrTooManyKeyRequests ID.
+func NewErrTooManyKeyRequests(ctx *context.T) error {
+	return verror.New(ErrTooManyKeyRequests, ctx)
+}
+
 var __VDLInitCalled bool
 
 // __VDLInit performs vdl initialization.  It is safe to call multiple times.
@@ -50,6 +62,8 @@ func __VDLInit() struct{} {
 
 	// Set error format strings.
 	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrKeyRejected.ID), "{1:}{2:} receiver rejected key {3} for lock {4}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrKeyRequestDenied.ID), "{1:}{2:} user {4} denied the request for a key to lock {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrTooManyKeyRequests.ID), "{1:}{2:} too many pending requests for keys")
 
 	return struct{}{}
 }
@@ -0,0 +1,81 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/security/access"
+
+	"v.io/x/lib/cmdline"
+	"v.io/x/lock"
+)
+
+func runPermsGet(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 1 {
+		return fmt.Errorf("requires exactly one argument <lock>, provided %d", numargs)
+	}
+	lockName := args[0]
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	perms, version, err := lock.LockAdminClient(lockAdminObjName(lockName)).GetPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(perms, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, string(data))
+	fmt.Fprintf(env.Stderr, "Version: %v\n", version)
+	return nil
+}
+
+func runPermsSet(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 2 {
+		return fmt.Errorf("requires exactly two arguments <lock> <file>, provided %d", numargs)
+	}
+	lockName, file := args[0], args[1]
+
+	var r io.Reader = env.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	perms, err := access.ReadPermissions(r)
+	if err != nil {
+		return fmt.Errorf("failed to read permissions from %v: %v", file, err)
+	}
+
+	ctx, stop, err := withLocalNamespace(ctx, "", lockUserNhName(ctx))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := lock.LockAdminClient(lockAdminObjName(lockName)).SetPermissions(ctx, perms, flagPermsVersion); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "Set the permissions of lock %v\n", lockName)
+	return nil
+}
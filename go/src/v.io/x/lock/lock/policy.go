@@ -0,0 +1,98 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"v.io/v23/security"
+)
+
+// recvKeyPolicy determines the keys that recvkey accepts without asking for
+// confirmation (see --policy). It is read from a JSON file, an example of
+// which is in the documentation of recvkey. A key is accepted if it matches
+// any of the rules, and rejected otherwise.
+type recvKeyPolicy struct {
+	Rules []recvKeyRule
+}
+
+// recvKeyRule matches the keys to any of Locks sent by any of Senders (as
+// listed by the users command), where "*" matches any lock or sender. If
+// MaxDuration is set, the keys must also expire within MaxDuration of their
+// receipt.
+type recvKeyRule struct {
+	Senders     []string
+	Locks       []string
+	MaxDuration string
+
+	maxDuration time.Duration
+}
+
+func loadRecvKeyPolicy(file string) (*recvKeyPolicy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p recvKeyPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %v: %v", file, err)
+	}
+	if len(p.Rules) == 0 {
+		return nil, fmt.Errorf("policy %v has no rules", file)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if len(r.Senders) == 0 || len(r.Locks) == 0 {
+			return nil, fmt.Errorf("rule %d of policy %v must list Senders and Locks", i, file)
+		}
+		if r.MaxDuration == "" {
+			continue
+		}
+		if r.maxDuration, err = time.ParseDuration(r.MaxDuration); err != nil || r.maxDuration <= 0 {
+			return nil, fmt.Errorf("rule %d of policy %v has invalid MaxDuration %q", i, file, r.MaxDuration)
+		}
+	}
+	return &p, nil
+}
+
+// accept returns nil if the key to the lock lockName, sent by sender, is
+// accepted by the policy, or the reason it is rejected otherwise.
+func (p *recvKeyPolicy) accept(lockName, sender string, key security.Blessings) error {
+	var reason error
+	for _, r := range p.Rules {
+		if !matches(r.Senders, sender) || !matches(r.Locks, lockName) {
+			continue
+		}
+		if r.maxDuration == 0 {
+			return nil
+		}
+		exp := key.Expiry()
+		if exp.IsZero() {
+			reason = fmt.Errorf("key never expires, want a key valid for at most %v", r.maxDuration)
+			continue
+		}
+		if d := exp.Sub(time.Now()); d > r.maxDuration {
+			reason = fmt.Errorf("key is valid for %v, want at most %v", d, r.maxDuration)
+			continue
+		}
+		return nil
+	}
+	if reason == nil {
+		reason = fmt.Errorf("no rule accepts keys for lock %v from user %v", lockName, sender)
+	}
+	return reason
+}
+
+func matches(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == s {
+			return true
+		}
+	}
+	return false
+}
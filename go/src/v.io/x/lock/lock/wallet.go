@@ -0,0 +1,252 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/vom"
+
+	"v.io/x/lib/cmdline"
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+const walletFileName = "wallet.json"
+
+// walletEntry describes a key saved by this client, beyond what the
+// BlessingStore records.
+type walletEntry struct {
+	// Key is the key that the entry describes, as printed. An entry whose
+	// key differs from the one in the BlessingStore is stale, e.g. when the
+	// key was replaced without being recorded.
+	Key string
+	// From is where the key was obtained: the user who sent it, or "file
+	// <path>" if it was imported (see importkey). It is empty if the key
+	// was obtained by claiming the lock.
+	From string
+	// Received is the time at which the key was saved.
+	Received time.Time
+	// Category is the category under which the key was extended for this
+	// client, empty if the key was obtained by claiming the lock.
+	Category string
+	// Caveats describes the caveats of the key.
+	Caveats []string
+}
+
+// wallet maps the public keys of principals, as printed, to the descriptions
+// of their keys by the names of the locks they are keys to. It is stored in
+// walletFile, which is shared by all the principals of the user.
+type wallet map[string]map[string]walletEntry
+
+func walletFile() (string, error) {
+	home := os.Getenv("HOME")
+	if len(home) == 0 {
+		return "", fmt.Errorf("HOME is not set, cannot locate %v", walletFileName)
+	}
+	return filepath.Join(home, ".lock", walletFileName), nil
+}
+
+func loadWallet() (wallet, error) {
+	file, err := walletFile()
+	if err != nil {
+		return nil, err
+	}
+	w := make(wallet)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return w, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	return w, nil
+}
+
+func (w wallet) save() error {
+	file, err := walletFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// recordKey records in the wallet that key, to the lock lockName, was saved
+// by the principal it is bound to after being obtained from from (see
+// walletEntry.From). The key is saved regardless of whether it can be
+// recorded, so failures are only logged.
+func recordKey(key security.Blessings, lockName, from string) {
+	w, err := loadWallet()
+	if err != nil {
+		vlog.Errorf("Failed to load wallet: %v", err)
+		return
+	}
+	w.entries(key.PublicKey())[lockName] = walletEntry{
+		Key:      fmt.Sprint(key),
+		From:     from,
+		Received: time.Now(),
+		Category: keyCategory(key, lockName),
+		Caveats:  describeCaveats(key),
+	}
+	if err := w.save(); err != nil {
+		vlog.Errorf("Failed to record key %v for lock %v in wallet: %v", key, lockName, err)
+	}
+}
+
+// entries returns the entries of the principal with the provided public key,
+// which can be added to.
+func (w wallet) entries(publicKey security.PublicKey) map[string]walletEntry {
+	id := fmt.Sprint(publicKey)
+	if w[id] == nil {
+		w[id] = make(map[string]walletEntry)
+	}
+	return w[id]
+}
+
+// keyCategory returns the category that key, to the lock lockName, was
+// extended under for this client, i.e. the last extension of the key.
+func keyCategory(key security.Blessings, lockName string) string {
+	prefix := lockName + security.ChainSeparator + "key" + security.ChainSeparator
+	for _, b := range strings.Split(key.String(), ",") {
+		if strings.HasPrefix(b, prefix) {
+			parts := strings.Split(b, security.ChainSeparator)
+			return parts[len(parts)-1]
+		}
+	}
+	return ""
+}
+
+// describeCaveats returns a human-readable description of the caveats of
+// key, such as its expiry and the peers it may be presented to.
+func describeCaveats(key security.Blessings) []string {
+	var ret []string
+	for _, chain := range security.MarshalBlessings(key).CertificateChains {
+		for _, cert := range chain {
+			for _, cav := range cert.Caveats {
+				ret = append(ret, describeCaveat(cav))
+			}
+		}
+	}
+	return ret
+}
+
+func describeCaveat(cav security.Caveat) string {
+	switch cav.Id {
+	case security.ExpiryCaveat.Id:
+		var t time.Time
+		if err := vom.Decode(cav.ParamVom, &t); err == nil {
+			return "expires " + t.Format(time.RFC3339)
+		}
+	case security.PeerBlessingsCaveat.Id:
+		var patterns []security.BlessingPattern
+		if err := vom.Decode(cav.ParamVom, &patterns); err == nil {
+			return fmt.Sprintf("peers %v", patterns)
+		}
+	case security.MethodCaveat.Id:
+		var methods []string
+		if err := vom.Decode(cav.ParamVom, &methods); err == nil {
+			return fmt.Sprintf("methods %v", methods)
+		}
+	case lock.MaxDepthCaveat.Id:
+		var max uint32
+		if err := vom.Decode(cav.ParamVom, &max); err == nil {
+			return fmt.Sprintf("max-depth %d", max)
+		}
+	}
+	return fmt.Sprintf("caveat %v", cav.Id)
+}
+
+// walletKey is a key as listed by listkeys.
+type walletKey struct {
+	Lock    string
+	Expiry  time.Time // zero if the key never expires
+	Expired bool
+	walletEntry
+}
+
+// walletKeys returns the keys to locks in the BlessingStore, along with
+// their descriptions from the wallet, ordered by lock name. Entries of the
+// wallet whose keys are not in the BlessingStore (any longer) are ignored.
+func walletKeys(ctx *context.T) ([]walletKey, error) {
+	w, err := loadWallet()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ret     []walletKey
+		now     = time.Now()
+		p       = v23.GetPrincipal(ctx)
+		entries = w.entries(p.PublicKey())
+	)
+	for peer, key := range p.BlessingStore().PeerBlessings() {
+		lockName := string(peer)
+		if !isValidLockName(lockName) {
+			continue
+		}
+		if !isKeyValidForLock(ctx, key, lockName) {
+			continue
+		}
+		k := walletKey{Lock: lockName, Expiry: key.Expiry()}
+		k.Expired = !k.Expiry.IsZero() && k.Expiry.Before(now)
+		if e, ok := entries[lockName]; ok && e.Key == fmt.Sprint(key) {
+			k.walletEntry = e
+		} else {
+			k.walletEntry = walletEntry{Key: fmt.Sprint(key), Category: keyCategory(key, lockName), Caveats: describeCaveats(key)}
+		}
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Lock < ret[j].Lock })
+	return ret, nil
+}
+
+func runPruneKeys(ctx *context.T, env *cmdline.Env, args []string) error {
+	if numargs := len(args); numargs != 0 {
+		return fmt.Errorf("requires no arguments, provided %d", numargs)
+	}
+	keys, err := walletKeys(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := loadWallet()
+	if err != nil {
+		return err
+	}
+	p := v23.GetPrincipal(ctx)
+	store, entries := p.BlessingStore(), w.entries(p.PublicKey())
+	for _, k := range keys {
+		if !k.Expired {
+			continue
+		}
+		if _, err := store.Set(security.Blessings{}, security.BlessingPattern(k.Lock)); err != nil {
+			return fmt.Errorf("failed to remove key %v for lock %v: %v", k.Key, k.Lock, err)
+		}
+		delete(entries, k.Lock)
+		fmt.Printf("Removed key %v for lock %v, which expired at %v\n", k.Key, k.Lock, k.Expiry.Format(time.RFC3339))
+	}
+	return w.save()
+}
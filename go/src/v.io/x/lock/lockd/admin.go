@@ -0,0 +1,208 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+	"v.io/v23/verror"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+type lockAdmin struct {
+	l      *lockInstance
+	name   string
+	nhName string
+	perms  *permsStore
+}
+
+func (a *lockAdmin) Diagnostics(ctx *context.T, call rpc.ServerCall) (_ lock.LockDiagnostics, err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("Diagnostics called by %q", remoteBlessingNames)
+	defer func() { recordRPC(a.l.id, "Diagnostics", callerCategory(a.name, remoteBlessingNames), err) }()
+
+	usage, err := diskUsage(a.l.configDir)
+	if err != nil {
+		return lock.LockDiagnostics{}, verror.Convert(verror.ErrInternal, ctx, err)
+	}
+	info := a.l.hw.Info()
+	actuations, lastErr, lastErrTime := a.l.hw.stats()
+	d := lock.LockDiagnostics{
+		Version:          version,
+		Uptime:           time.Since(startTime),
+		Hardware:         info.Backend,
+		Pins:             info.Pins,
+		Actuations:       actuations,
+		ConfigDirBytes:   usage,
+		NeighborhoodName: a.nhName,
+	}
+	if lastErr != nil {
+		d.LastHardwareError = lastErr.Error()
+		d.LastHardwareErrorTime = lastErrTime
+	}
+	d.BatteryLevel = -1
+	if a.l.power != nil {
+		if d.BatteryLevel, err = a.l.power.BatteryLevel(); err != nil {
+			return lock.LockDiagnostics{}, verror.Convert(verror.ErrInternal, ctx, err)
+		}
+	}
+	return d, nil
+}
+
+func (a *lockAdmin) AddPIN(ctx *context.T, call rpc.ServerCall, pin string, info lock.PINInfo) (err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("AddPIN(%q) called by %q", info.Label, remoteBlessingNames)
+	defer func() {
+		recordRPC(a.l.id, "AddPIN", callerCategory(a.name, remoteBlessingNames), err)
+		a.l.audit.record(auditEvent{Event: auditAddPIN, Blessings: remoteBlessingNames, PIN: info.Label, Error: errorString(err)})
+	}()
+
+	switch {
+	case len(info.Label) == 0:
+		return NewErrInvalidPIN(ctx, "the label must not be empty")
+	case !pinRE.MatchString(pin):
+		return NewErrInvalidPIN(ctx, "a PIN must consist of 4 to 12 digits")
+	case !info.NotBefore.IsZero() && !info.NotAfter.IsZero() && info.NotAfter.Before(info.NotBefore):
+		return NewErrInvalidPIN(ctx, "the end of the validity period is before its start")
+	}
+	switch err := a.l.pins.add(pin, info); err {
+	case nil:
+		return nil
+	case errPINExists:
+		return verror.New(verror.ErrExist, ctx, info.Label)
+	default:
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+}
+
+func (a *lockAdmin) RemovePIN(ctx *context.T, call rpc.ServerCall, label string) (err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("RemovePIN(%q) called by %q", label, remoteBlessingNames)
+	defer func() {
+		recordRPC(a.l.id, "RemovePIN", callerCategory(a.name, remoteBlessingNames), err)
+		a.l.audit.record(auditEvent{Event: auditRemovePIN, Blessings: remoteBlessingNames, PIN: label, Error: errorString(err)})
+	}()
+
+	switch err := a.l.pins.remove(label); err {
+	case nil:
+		return nil
+	case errPINNotFound:
+		return verror.New(verror.ErrNoExist, ctx, label)
+	default:
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+}
+
+func (a *lockAdmin) ListPINs(ctx *context.T, call rpc.ServerCall) ([]lock.PINInfo, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("ListPINs called by %q", remoteBlessingNames)
+	recordRPC(a.l.id, "ListPINs", callerCategory(a.name, remoteBlessingNames), nil)
+	return a.l.pins.list(), nil
+}
+
+func (a *lockAdmin) Watch(ctx *context.T, call lock.LockAdminWatchServerCall) (err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("Watch called by %q", remoteBlessingNames)
+	defer func() { recordRPC(a.l.id, "Watch", callerCategory(a.name, remoteBlessingNames), err) }()
+
+	events, stop := a.l.watchers.add()
+	defer stop()
+	for {
+		select {
+		case e := <-events:
+			if err := call.SendStream().Send(e); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (a *lockAdmin) AcknowledgeAlarm(ctx *context.T, call rpc.ServerCall, id uint64) (err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("AcknowledgeAlarm(%d) called by %q", id, remoteBlessingNames)
+	defer func() {
+		recordRPC(a.l.id, "AcknowledgeAlarm", callerCategory(a.name, remoteBlessingNames), err)
+		a.l.audit.record(auditEvent{Event: auditAckAlarm, Blessings: remoteBlessingNames, AlarmID: id, Error: errorString(err)})
+	}()
+
+	switch err := a.l.alarms.acknowledge(id); err {
+	case nil:
+		return nil
+	case errAlarmNotFound:
+		return verror.New(verror.ErrNoExist, ctx, id)
+	default:
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+}
+
+func (a *lockAdmin) Lockouts(ctx *context.T, call rpc.ServerCall) ([]lock.Lockout, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("Lockouts called by %q", remoteBlessingNames)
+	recordRPC(a.l.id, "Lockouts", callerCategory(a.name, remoteBlessingNames), nil)
+	return a.l.lockouts.list(), nil
+}
+
+func (a *lockAdmin) ListKeyHolders(ctx *context.T, call rpc.ServerCall) ([]lock.KeyHolder, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("ListKeyHolders called by %q", remoteBlessingNames)
+	recordRPC(a.l.id, "ListKeyHolders", callerCategory(a.name, remoteBlessingNames), nil)
+	return a.l.holders.list(), nil
+}
+
+func (a *lockAdmin) GetPermissions(ctx *context.T, call rpc.ServerCall) (access.Permissions, string, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("GetPermissions called by %q", remoteBlessingNames)
+	recordRPC(a.l.id, "GetPermissions", callerCategory(a.name, remoteBlessingNames), nil)
+	perms, version := a.perms.get()
+	return perms, version, nil
+}
+
+func (a *lockAdmin) SetPermissions(ctx *context.T, call rpc.ServerCall, perms access.Permissions, version string) (err error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("SetPermissions(%v, %q) called by %q", perms, version, remoteBlessingNames)
+	defer func() {
+		recordRPC(a.l.id, "SetPermissions", callerCategory(a.name, remoteBlessingNames), err)
+		a.l.audit.record(auditEvent{Event: auditSetPerms, Blessings: remoteBlessingNames, Error: errorString(err)})
+	}()
+	switch err := a.perms.set(perms, version); err {
+	case nil:
+		return nil
+	case errBadVersion:
+		return verror.New(verror.ErrBadVersion, ctx)
+	case errOwnerNotAdmin:
+		return NewErrOwnerNotAdmin(ctx, a.perms.owner)
+	default:
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+}
+
+// diskUsage returns the total size, in bytes, of the regular files under dir.
+func diskUsage(dir string) (uint64, error) {
+	var total uint64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	return total, err
+}
+
+func newLockAdmin(l *lockInstance, name, nhName string, perms *permsStore) lock.LockAdminServerStub {
+	return lock.LockAdminServer(&lockAdmin{l: l, name: name, nhName: nhName, perms: perms})
+}
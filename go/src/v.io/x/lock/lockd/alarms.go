@@ -0,0 +1,143 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+const (
+	alarmsFileName = "alarms.json"
+	// maxAlarms is the number of alarms kept by alarmStore, beyond which the
+	// oldest ones are forgotten.
+	maxAlarms = 100
+)
+
+var errAlarmNotFound = errors.New("alarm not found")
+
+// alarmStore holds the alarms raised by a lock, oldest first, in a file in
+// the lock's configuration directory.
+type alarmStore struct {
+	path string
+
+	mu     sync.Mutex
+	alarms []lock.Alarm // GUARDED_BY(mu)
+}
+
+func loadAlarmStore(dir string) (*alarmStore, error) {
+	s := &alarmStore{path: filepath.Join(dir, alarmsFileName)}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.alarms); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// raise adds an alarm of the provided kind, raised at time now, to the store
+// and returns it. The alarm is returned even if it could not be saved.
+func (s *alarmStore) raise(kind lock.AlarmKind, now time.Time) (lock.Alarm, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := lock.Alarm{ID: 1, Kind: kind, Time: now}
+	if n := len(s.alarms); n > 0 {
+		a.ID = s.alarms[n-1].ID + 1
+	}
+	s.alarms = append(s.alarms, a)
+	if n := len(s.alarms); n > maxAlarms {
+		s.alarms = append([]lock.Alarm(nil), s.alarms[n-maxAlarms:]...)
+	}
+	return a, s.saveLocked()
+}
+
+// acknowledge marks the alarm with the provided ID as acknowledged, or returns
+// errAlarmNotFound if there is no such alarm in the store.
+func (s *alarmStore) acknowledge(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.alarms {
+		if s.alarms[i].ID != id {
+			continue
+		}
+		if s.alarms[i].Acknowledged {
+			return nil
+		}
+		s.alarms[i].Acknowledged = true
+		if err := s.saveLocked(); err != nil {
+			s.alarms[i].Acknowledged = false
+			return err
+		}
+		return nil
+	}
+	return errAlarmNotFound
+}
+
+// list returns the alarms in the store, most recent first.
+func (s *alarmStore) list() []lock.Alarm {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]lock.Alarm, len(s.alarms))
+	for i, a := range s.alarms {
+		ret[len(ret)-1-i] = a
+	}
+	return ret
+}
+
+// REQUIRES: s.mu is held.
+func (s *alarmStore) saveLocked() error {
+	data, err := json.Marshal(s.alarms)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// raiseAlarm records an alarm of the provided kind, notifies the watchers of
+// the lock and, if the lock is so configured, sounds its buzzer.
+func (l *lockInstance) raiseAlarm(kind lock.AlarmKind) {
+	a, err := l.alarms.raise(kind, time.Now())
+	if err != nil {
+		vlog.Errorf("Failed to save %v alarm of lock %q: %v", kind, l.id, err)
+	}
+	vlog.Infof("Lock %q raised %v alarm %d", l.id, kind, a.ID)
+	l.audit.record(auditEvent{Event: auditAlarm, Alarm: kind.String(), AlarmID: a.ID})
+	// raiseAlarm may be called with l.actuating held, so the state of the
+	// lock is read from its hardware rather than from l.status.
+	l.watchers.send(lock.LockEvent{Time: a.Time, Status: l.hw.Status(), Cause: lock.LockEventCauseAlarm, Alarm: a})
+	if b, ok := l.rawHW.(internal.Buzzer); ok && l.tamperConfig.Buzz.Duration > 0 {
+		go b.Buzz(l.tamperConfig.Buzz.Duration)
+	}
+}
+
+// checkEnclosure raises an alarm if the enclosure of the lock device has
+// been opened since it was last checked.
+func (l *lockInstance) checkEnclosure() {
+	if l.enclosure == nil {
+		return
+	}
+	open := l.enclosure.Open()
+	if open && !l.enclosureOpen {
+		l.raiseAlarm(lock.AlarmKindEnclosure)
+	}
+	l.enclosureOpen = open
+}
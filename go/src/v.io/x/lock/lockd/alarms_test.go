@@ -0,0 +1,56 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+func TestRaiseAlarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockd-alarms-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := newLockInstance("", dir, scenarioConfig(t, dir, internal.Scenario{Unlocked: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.audit.f.Close()
+	events, stop := l.watchers.add()
+	defer stop()
+
+	l.raiseAlarm(lock.AlarmKindEnclosure)
+	l.raiseAlarm(lock.AlarmKindKeypad)
+	alarms := l.alarms.list()
+	if len(alarms) != 2 || alarms[0].Kind != lock.AlarmKindKeypad || alarms[1].Kind != lock.AlarmKindEnclosure {
+		t.Fatalf("got alarms %v, want a Keypad alarm and an Enclosure alarm", alarms)
+	}
+	// The watchers of the lock are notified of every alarm, in order.
+	for _, want := range []lock.Alarm{alarms[1], alarms[0]} {
+		select {
+		case e := <-events:
+			if e.Cause != lock.LockEventCauseAlarm || e.Status != lock.Unlocked || e.Alarm.ID != want.ID || e.Alarm.Kind != want.Kind || !e.Time.Equal(want.Time) {
+				t.Errorf("got event %+v, want an Alarm event for %+v while unlocked", e, want)
+			}
+		default:
+			t.Fatalf("no event for alarm %+v", want)
+		}
+	}
+
+	// The alarms are persisted.
+	reloaded, err := loadAlarmStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.list(); len(got) != len(alarms) {
+		t.Errorf("got %d alarms after reloading, want %d", len(got), len(alarms))
+	}
+}
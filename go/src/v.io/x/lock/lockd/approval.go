@@ -0,0 +1,93 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+	"v.io/v23/options"
+	"v.io/v23/security"
+	"v.io/v23/verror"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock/lockd/internal"
+	"v.io/x/lock/locklib"
+)
+
+// approvalPolicy determines the unlocks that require the approval of the
+// owner of a lock (see internal.ApprovalConfig).
+type approvalPolicy struct {
+	mu  sync.Mutex
+	cfg internal.ApprovalConfig // GUARDED_BY(mu)
+}
+
+func newApprovalPolicy(cfg internal.ApprovalConfig) *approvalPolicy {
+	return &approvalPolicy{cfg: cfg}
+}
+
+func (p *approvalPolicy) setConfig(cfg internal.ApprovalConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+}
+
+// required returns true, along with the time for which to wait for the
+// approval, if the unlocks by callers of the provided category (see
+// callerCategory) require approval.
+func (p *approvalPolicy) required(category string) (internal.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.cfg.Categories {
+		if c == category {
+			return p.cfg.Timeout, true
+		}
+	}
+	return internal.Duration{}, false
+}
+
+// requestApproval asks the owner of the lock named lockName, through the
+// agent of its client (see "lock agent"), whether the caller with the provided
+// blessing names may unlock the lock. It returns nil if the owner approves
+// within timeout.
+func (l *lockInstance) requestApproval(ctx *context.T, lockName string, blessings []string, timeout internal.Duration) error {
+	o, ok, err := loadOwner(l.configDir)
+	if err != nil {
+		return verror.Convert(verror.ErrInternal, ctx, err)
+	}
+	if !ok {
+		return NewErrUnlockNotApproved(ctx, "the owner of the lock is unknown, the lock must be claimed again")
+	}
+	name := naming.Join("nh", locklib.UserNhPrefix+locklib.User(o.Blessings...), locklib.AgentSuffix)
+	vlog.Infof("Requesting approval of the unlock of lock %q by %q from %v", l.id, blessings, name)
+	ctx, cancel := context.WithTimeout(ctx, timeout.Duration)
+	defer cancel()
+	var approved bool
+	if err := v23.GetClient(ctx).Call(ctx, name, "ApproveUnlock", []interface{}{lockName, blessings}, []interface{}{&approved}, options.ServerAuthorizer{ownerKeyAuthorizer{o.Key}}); err != nil {
+		vlog.Infof("Failed to obtain approval of the unlock of lock %q: %v", l.id, err)
+		return NewErrUnlockNotApproved(ctx, fmt.Sprintf("could not reach the owner within %v", timeout))
+	}
+	if !approved {
+		return NewErrUnlockNotApproved(ctx, "denied by the owner")
+	}
+	return nil
+}
+
+// ownerKeyAuthorizer is a security.Authorizer that authorizes the principal
+// with the provided public key, which is used to authenticate the client of
+// the owner of the lock regardless of its blessings.
+type ownerKeyAuthorizer struct {
+	key string
+}
+
+func (a ownerKeyAuthorizer) Authorize(ctx *context.T, call security.Call) error {
+	if key := remoteKey(call); key != a.key {
+		return fmt.Errorf("peer has key %v, not that of the owner of the lock (%v)", key, a.key)
+	}
+	return nil
+}
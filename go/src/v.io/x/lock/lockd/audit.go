@@ -0,0 +1,104 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+)
+
+const auditLogFileName = "audit.log"
+
+// Kinds of auditEvent.
+const (
+	auditLock         = "lock"
+	auditUnlock       = "unlock"
+	auditPINUnlock    = "pin-unlock"
+	auditAddPIN       = "add-pin"
+	auditRemovePIN    = "remove-pin"
+	auditManualLock   = "manual-lock"
+	auditManualUnlock = "manual-unlock"
+	auditAlarm        = "alarm"
+	auditAckAlarm     = "acknowledge-alarm"
+	auditLowBattery   = "low-battery"
+	auditRestore      = "restore"
+	auditLockout      = "lockout"
+	auditUnlockReq    = "unlock-request"
+	auditSetPerms     = "set-permissions"
+)
+
+// auditEvent is an entry of the audit log of a lock.
+type auditEvent struct {
+	Time time.Time
+	// Event is the kind of event, e.g. auditUnlock.
+	Event string
+	// Blessings are the blessing names of the caller, for events caused by
+	// RPCs.
+	Blessings []string `json:",omitempty"`
+	// PIN is the label of the PIN involved, for events caused by PINs.
+	PIN string `json:",omitempty"`
+	// Alarm and AlarmID are the kind and ID of the alarm involved, for
+	// events related to alarms.
+	Alarm   string `json:",omitempty"`
+	AlarmID uint64 `json:",omitempty"`
+	// Battery is the level of the battery, in percent, for low-battery
+	// events.
+	Battery int32 `json:",omitempty"`
+	// Key is the public key of the caller, for lockout events.
+	Key string `json:",omitempty"`
+	// RequestedBy are the blessing names of the caller that requested an
+	// unlock confirmed by the caller, under the two-person rule.
+	RequestedBy []string `json:",omitempty"`
+	// Approved is true for unlocks approved by the owner of the lock.
+	Approved bool `json:",omitempty"`
+	// Error describes why the event failed, and is empty if it succeeded.
+	Error string `json:",omitempty"`
+}
+
+// auditLog records the events that affect a lock in a file in its
+// configuration directory, as one JSON-encoded auditEvent per line, so that
+// owners can find out who locked or unlocked the lock and when.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File // GUARDED_BY(mu)
+}
+
+func openAuditLog(dir string) (*auditLog, error) {
+	f, err := os.OpenFile(filepath.Join(dir, auditLogFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+// record appends e, with the current time, to the audit log. Failures are
+// logged, but do not otherwise affect the caller.
+func (a *auditLog) record(e auditEvent) {
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		vlog.Errorf("Failed to encode audit event %+v: %v", e, err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.f.Write(append(data, '\n')); err != nil {
+		vlog.Errorf("Failed to record audit event %+v: %v", e, err)
+	}
+}
+
+// errorString returns the description of err, or an empty string if err is
+// nil, for auditEvent.Error.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
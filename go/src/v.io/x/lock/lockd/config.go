@@ -0,0 +1,118 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock/lockd/internal"
+)
+
+// reloadConfigOnSIGHUP re-reads the configuration file in configDir and
+// applies it every time lockd receives SIGHUP. An invalid configuration file
+// is reported and otherwise ignored, leaving the current configuration in
+// effect.
+//
+// Returns a callback to be invoked to stop reloading.
+func reloadConfigOnSIGHUP(configDir string, locks []*lockInstance, metrics *metricsServer) func() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sighup:
+				reloadConfig(configDir, locks, metrics)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sighup)
+		close(done)
+	}
+}
+
+// reloadConfig applies the configuration in configDir to the hardware of each
+// of the locks and to metrics.
+func reloadConfig(configDir string, locks []*lockInstance, metrics *metricsServer) {
+	path := filepath.Join(configDir, internal.ConfigFile)
+	vlog.Infof("Reloading configuration from %v", path)
+	cfg, err := internal.LoadConfig(configDir)
+	if err != nil {
+		vlog.Errorf("Not reloading configuration: %v", err)
+		return
+	}
+	hwCfgs := hardwareConfigs(cfg)
+	for _, l := range locks {
+		hwCfg, ok := hwCfgs[l.id]
+		if !ok || len(hwCfgs) != len(locks) {
+			vlog.Errorf("Not reloading configuration from %v: cannot add or remove locks without restarting", path)
+			return
+		}
+		if b := hardwareBackend(hwCfg); b != l.backend {
+			vlog.Errorf("Not reloading configuration from %v: cannot switch lock %q from %q to %q hardware without restarting", path, l.id, l.backend, b)
+			return
+		}
+	}
+	for _, l := range locks {
+		if hwCfg := hwCfgs[l.id]; !reflect.DeepEqual(hwCfg.Keypad, l.keypadConfig) {
+			vlog.Errorf("Not reloading the keypad configuration of lock %q from %v: changing it requires restarting", l.id, path)
+		}
+		if hwCfg := hwCfgs[l.id]; hwCfg.Tamper != l.tamperConfig {
+			vlog.Errorf("Not reloading the tamper detection configuration of lock %q from %v: changing it requires restarting", l.id, path)
+		}
+		if hwCfg := hwCfgs[l.id]; hwCfg.Power != l.powerConfig {
+			vlog.Errorf("Not reloading the power configuration of lock %q from %v: changing it requires restarting", l.id, path)
+		}
+		if hwCfg := hwCfgs[l.id]; hwCfg.StartupPolicy != l.startupPolicy {
+			vlog.Errorf("Not reloading the startup policy of lock %q from %v: it only applies when lockd starts", l.id, path)
+		}
+		l.setPollInterval(hwCfgs[l.id].PollInterval.Duration)
+		l.lockouts.setConfig(hwCfgs[l.id].Lockout)
+		l.twoPerson.setConfig(hwCfgs[l.id].TwoPerson)
+		l.approval.setConfig(hwCfgs[l.id].Approval)
+		r, ok := l.rawHW.(internal.Reconfigurable)
+		if !ok {
+			continue
+		}
+		if err := r.Reconfigure(hwCfgs[l.id]); err != nil {
+			vlog.Errorf("Not reloading the hardware configuration of lock %q from %v: %v", l.id, path, err)
+		}
+	}
+	setMetricsCategories(cfg.MetricsCategories)
+	if err := metrics.listen(metricsAddress(cfg)); err != nil {
+		vlog.Errorf("Failed to serve metrics: %v", err)
+	}
+	vlog.Infof("Reloaded configuration from %v", path)
+}
+
+// metricsAddress returns the address on which metrics must be served: the
+// value of --metrics-addr if set, or that in the configuration otherwise.
+func metricsAddress(cfg internal.Config) string {
+	if len(metricsAddr) > 0 {
+		return metricsAddr
+	}
+	return cfg.MetricsAddr
+}
+
+// hardwareBackend returns the name of the hardware backend to use: the value
+// of --hardware if set, that in the configuration if set, or the default
+// backend otherwise.
+func hardwareBackend(cfg internal.HardwareConfig) string {
+	if len(hardware) > 0 {
+		return hardware
+	}
+	if len(cfg.Backend) > 0 {
+		return cfg.Backend
+	}
+	return internal.DefaultBackend()
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/vom"
+
+	"v.io/x/lock"
+)
+
+// depthAuthorizer is a security.Authorizer that refuses the calls by callers
+// that present a key extended further than a lock.MaxDepthCaveat on it
+// permits, and defers to the wrapped Authorizer otherwise.
+type depthAuthorizer struct {
+	security.Authorizer
+}
+
+func (a depthAuthorizer) Authorize(ctx *context.T, call security.Call) error {
+	for _, chain := range security.MarshalBlessings(call.RemoteBlessings()).CertificateChains {
+		if max, ok := exceededDepth(chain); ok {
+			return NewErrKeyTooDeep(ctx, chainName(chain), max)
+		}
+	}
+	return a.Authorizer.Authorize(ctx, call)
+}
+
+// exceededDepth returns true, along with the permitted depth, if chain
+// extends a certificate that carries a lock.MaxDepthCaveat by more
+// certificates than the caveat permits.
+func exceededDepth(chain []security.Certificate) (uint32, bool) {
+	for i, cert := range chain {
+		for _, cav := range cert.Caveats {
+			if cav.Id != lock.MaxDepthCaveat.Id {
+				continue
+			}
+			var max uint32
+			if err := vom.Decode(cav.ParamVom, &max); err != nil {
+				// A caveat that cannot be decoded permits no
+				// extension at all.
+				max = 0
+			}
+			if uint32(len(chain)-1-i) > max {
+				return max, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func chainName(chain []security.Certificate) string {
+	names := make([]string, len(chain))
+	for i, cert := range chain {
+		names[i] = cert.Extension
+	}
+	return strings.Join(names, security.ChainSeparator)
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"v.io/v23/security"
+	"v.io/v23/verror"
+
+	"v.io/x/lock"
+	"v.io/x/ref/test"
+	"v.io/x/ref/test/testutil"
+)
+
+func maxDepthCaveat(t *testing.T, max uint32) security.Caveat {
+	cav, err := security.NewCaveat(lock.MaxDepthCaveat, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cav
+}
+
+func TestExceededDepth(t *testing.T) {
+	undecodable := security.Caveat{Id: lock.MaxDepthCaveat.Id, ParamVom: []byte{0xff}}
+	tests := []struct {
+		name string
+		// caveats are the caveats of each certificate of the chain.
+		caveats [][]security.Caveat
+		wantMax uint32
+		want    bool
+	}{
+		{
+			name:    "no caveat",
+			caveats: [][]security.Caveat{nil, nil, nil, nil, nil},
+		},
+		{
+			name:    "non-delegable key",
+			caveats: [][]security.Caveat{nil, nil, {maxDepthCaveat(t, 0)}},
+		},
+		{
+			name:    "non-delegable key extended",
+			caveats: [][]security.Caveat{nil, nil, {maxDepthCaveat(t, 0)}, nil},
+			wantMax: 0,
+			want:    true,
+		},
+		{
+			name:    "within the maximum depth",
+			caveats: [][]security.Caveat{nil, nil, {maxDepthCaveat(t, 2)}, nil, nil},
+		},
+		{
+			name:    "beyond the maximum depth",
+			caveats: [][]security.Caveat{nil, nil, {maxDepthCaveat(t, 2)}, nil, nil, nil},
+			wantMax: 2,
+			want:    true,
+		},
+		{
+			// Extensions cannot loosen the limit of the keys they
+			// extend.
+			name:    "looser caveat on an extension",
+			caveats: [][]security.Caveat{nil, nil, {maxDepthCaveat(t, 1)}, {maxDepthCaveat(t, 5)}, nil},
+			wantMax: 1,
+			want:    true,
+		},
+		{
+			name:    "undecodable caveat",
+			caveats: [][]security.Caveat{nil, nil, {undecodable}, nil},
+			wantMax: 0,
+			want:    true,
+		},
+	}
+	for _, test := range tests {
+		chain := make([]security.Certificate, len(test.caveats))
+		for i, cavs := range test.caveats {
+			chain[i] = security.Certificate{Extension: string('a' + rune(i)), Caveats: cavs}
+		}
+		if max, ok := exceededDepth(chain); max != test.wantMax || ok != test.want {
+			t.Errorf("%v: got (%v, %v), want (%v, %v)", test.name, max, ok, test.wantMax, test.want)
+		}
+	}
+}
+
+func TestDepthAuthorizer(t *testing.T) {
+	ctx, shutdown := test.V23Init()
+	defer shutdown()
+	lockP, ownerP, guestP, otherP := testutil.NewPrincipal(), testutil.NewPrincipal(), testutil.NewPrincipal(), testutil.NewPrincipal()
+	lockB, err := lockP.BlessSelf("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := security.AddToRoots(lockP, lockB); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := lockP.Bless(ownerP.PublicKey(), lockB, keyBlessingExtension, security.UnconstrainedUse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := ownerP.Bless(guestP.PublicKey(), owner, "guest", maxDepthCaveat(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegated, err := guestP.Bless(otherP.PublicKey(), guest, "x", security.UnconstrainedUse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := depthAuthorizer{fakeAuthorizer{}}
+	for _, test := range []struct {
+		name      string
+		blessings security.Blessings
+		want      verror.ID
+	}{
+		{"owner", owner, ""},
+		{"non-delegable key", guest, ""},
+		{"non-delegable key extended", delegated, ErrKeyTooDeep.ID},
+	} {
+		call := security.NewCall(&security.CallParams{Method: "Unlock", LocalPrincipal: lockP, RemoteBlessings: test.blessings})
+		if got := verror.ErrorID(auth.Authorize(ctx, call)); got != test.want {
+			t.Errorf("%v: got error ID %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+// watcherBufferSize is the number of events buffered for each watcher. Events
+// are dropped for watchers that fall further behind.
+const watcherBufferSize = 16
+
+// watchers distributes the events of a lock to the callers of
+// LockAdmin.Watch.
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan lock.LockEvent]bool // GUARDED_BY(mu)
+}
+
+func newWatchers() *watchers {
+	return &watchers{chans: make(map[chan lock.LockEvent]bool)}
+}
+
+// add returns a channel on which subsequent events are received, along with a
+// function to be invoked when they are no longer needed.
+func (w *watchers) add() (<-chan lock.LockEvent, func()) {
+	ch := make(chan lock.LockEvent, watcherBufferSize)
+	w.mu.Lock()
+	w.chans[ch] = true
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.chans, ch)
+		w.mu.Unlock()
+	}
+}
+
+func (w *watchers) send(e lock.LockEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.chans {
+		select {
+		case ch <- e:
+		default:
+			vlog.Infof("Dropped %v event for a slow watcher", e.Cause)
+		}
+	}
+}
+
+// setStatus changes the state of the lock on behalf of the caller described
+// by e (whose Time and Status are filled in), and notifies the watchers of the
+// lock if its state changed as a result.
+func (l *lockInstance) setStatus(status lock.LockStatus, e lock.LockEvent) error {
+	l.actuating.Lock()
+	defer l.actuating.Unlock()
+	if err := l.checkBattery(); err != nil {
+		return err
+	}
+	l.state.Commanded, l.state.Pending = status, true
+	l.saveStateLocked()
+	err := l.hw.SetStatus(status)
+	now := l.hw.Status()
+	l.state.Observed, l.state.Pending = now, false
+	l.saveStateLocked()
+	if now != l.status {
+		l.status = now
+		e.Time, e.Status = time.Now(), now
+		l.watchers.send(e)
+	}
+	return err
+}
+
+// monitorStatus polls the state of the lock, and its enclosure switch, every
+// pollInterval, forever, to notice the changes that lockd did not cause.
+func (l *lockInstance) monitorStatus() {
+	for {
+		time.Sleep(l.getPollInterval())
+		l.checkStatus()
+		l.checkEnclosure()
+	}
+}
+
+func (l *lockInstance) getPollInterval() time.Duration {
+	l.pollMu.Lock()
+	defer l.pollMu.Unlock()
+	return l.pollInterval
+}
+
+func (l *lockInstance) setPollInterval(interval time.Duration) {
+	l.pollMu.Lock()
+	defer l.pollMu.Unlock()
+	l.pollInterval = interval
+}
+
+// checkStatus attributes any change of the state of the lock since it was
+// last observed to the hardware, if it locks by itself, or to someone
+// operating the lock by hand. The latter are recorded in the audit log.
+func (l *lockInstance) checkStatus() {
+	l.actuating.Lock()
+	defer l.actuating.Unlock()
+	status := l.hw.Status()
+	if status == l.status {
+		return
+	}
+	l.status, l.state.Observed = status, status
+	l.saveStateLocked()
+	e := lock.LockEvent{Time: time.Now(), Status: status, Cause: lock.LockEventCauseManual}
+	if status == lock.Locked && l.hw.Info().Relocks {
+		e.Cause = lock.LockEventCauseAutomatic
+	} else {
+		vlog.Infof("Lock %q changed to %v by hand", l.id, status)
+		event := auditManualUnlock
+		if status == lock.Locked {
+			event = auditManualLock
+		}
+		l.audit.record(auditEvent{Event: event})
+		if status == lock.Unlocked && l.tamperConfig.ForcedBolt {
+			l.raiseAlarm(lock.AlarmKindForcedBolt)
+		}
+	}
+	l.watchers.send(e)
+}
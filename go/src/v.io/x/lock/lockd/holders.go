@@ -0,0 +1,137 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+const (
+	holdersFileName = "holders.json"
+	// holdersSaveInterval is the interval at which keyHolders saves the
+	// uses of known key holders. New key holders are saved right away.
+	holdersSaveInterval = time.Minute
+)
+
+// keyHolders records the distinct sets of blessings with which key holders
+// have called a lock, in a file in the lock's configuration directory.
+type keyHolders struct {
+	path string
+
+	mu       sync.Mutex
+	holders  map[string]*lock.KeyHolder // GUARDED_BY(mu), keyed by holderID
+	lastSave time.Time                  // GUARDED_BY(mu)
+}
+
+func loadKeyHolders(dir string) (*keyHolders, error) {
+	h := &keyHolders{path: filepath.Join(dir, holdersFileName), holders: make(map[string]*lock.KeyHolder)}
+	data, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var holders []lock.KeyHolder
+	if err := json.Unmarshal(data, &holders); err != nil {
+		return nil, err
+	}
+	for i := range holders {
+		h.holders[holderID(holders[i].Blessings)] = &holders[i]
+	}
+	return h, nil
+}
+
+// seen records a call by the key holder with the provided blessing names at
+// time now.
+func (h *keyHolders) seen(blessings []string, now time.Time) error {
+	if len(blessings) == 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := holderID(blessings)
+	k, ok := h.holders[id]
+	if !ok {
+		k = &lock.KeyHolder{Blessings: blessings, FirstSeen: now}
+		h.holders[id] = k
+	}
+	k.LastSeen = now
+	k.Uses++
+	if ok && now.Sub(h.lastSave) < holdersSaveInterval {
+		return nil
+	}
+	h.lastSave = now
+	return h.saveLocked()
+}
+
+// list returns the key holders, most recently seen first.
+func (h *keyHolders) list() []lock.KeyHolder {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := h.listLocked()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].LastSeen.After(ret[j].LastSeen) })
+	return ret
+}
+
+// REQUIRES: h.mu is held.
+func (h *keyHolders) listLocked() []lock.KeyHolder {
+	ret := make([]lock.KeyHolder, 0, len(h.holders))
+	for _, k := range h.holders {
+		ret = append(ret, *k)
+	}
+	return ret
+}
+
+// REQUIRES: h.mu is held.
+func (h *keyHolders) saveLocked() error {
+	data, err := json.Marshal(h.listLocked())
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// holderID identifies the key holder with the provided blessing names,
+// regardless of their order.
+func holderID(blessings []string) string {
+	sorted := append([]string(nil), blessings...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// holdersAuthorizer is a security.Authorizer that records the callers that
+// the wrapped Authorizer authorizes as key holders of the lock.
+type holdersAuthorizer struct {
+	security.Authorizer
+	l *lockInstance
+}
+
+func (a holdersAuthorizer) Authorize(ctx *context.T, call security.Call) error {
+	if err := a.Authorizer.Authorize(ctx, call); err != nil {
+		return err
+	}
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call)
+	if err := a.l.holders.seen(remoteBlessingNames, time.Now()); err != nil {
+		vlog.Errorf("Failed to save the key holders of lock %q: %v", a.l.id, err)
+	}
+	return nil
+}
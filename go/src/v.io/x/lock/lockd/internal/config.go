@@ -0,0 +1,736 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ConfigFile is the name of the configuration file in lockd's
+	// configuration directory.
+	ConfigFile = "lockd.conf"
+	// ConfigVersion is the version of the configuration file format
+	// understood by this package.
+	ConfigVersion = 1
+)
+
+var (
+	gpioPinRE  = regexp.MustCompile(`^GPIO([0-9]+)$`)
+	lockNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+)
+
+// LockDir returns the directory, under the configuration directory configDir,
+// in which the state of the lock named 'name' in Config.Locks is stored.
+func LockDir(configDir, name string) string {
+	return filepath.Join(configDir, "locks", name)
+}
+
+// Config is the configuration of lockd. It is read from ConfigFile, which is
+// a JSON encoding of this struct, e.g.:
+//
+//   {
+//     "Version": 1,
+//     "Hardware": {
+//       "Backend": "rpi",
+//       "RelayPin": "GPIO17",
+//       "MonitorPin": "GPIO22",
+//       "ToggleWait": "5s",
+//       "PollInterval": "200ms"
+//     },
+//     "MetricsAddr": "localhost:9090"
+//   }
+//
+// Fields that are not set take their values from DefaultConfig.
+//
+// A lockd that manages several locks lists them in Locks, e.g.:
+//
+//   {
+//     "Version": 1,
+//     "Hardware": {"Backend": "rpi"},
+//     "Locks": [
+//       {"Name": "front-door", "Hardware": {"RelayPin": "GPIO17", "MonitorPin": "GPIO22"}},
+//       {"Name": "garage", "Hardware": {"RelayPin": "GPIO23", "MonitorPin": "GPIO24"}}
+//     ]
+//   }
+//
+// in which case the settings in Hardware are the defaults for the hardware of
+// every lock.
+type Config struct {
+	// Version is the version of the configuration file format, and must be
+	// ConfigVersion.
+	Version int
+	// Hardware configures the hardware that manipulates the lock.
+	Hardware HardwareConfig
+	// MetricsAddr is the address (host:port) on which Prometheus metrics
+	// are served. Metrics are not served if empty. The --metrics-addr
+	// flag, if set, takes precedence.
+	MetricsAddr string
+	// MetricsCategories lists the categories of keys (e.g. "friend" for the
+	// key <lock>:key:friend) that label RPC metrics. Calls made with keys
+	// in other categories are labelled "other", since the senders of keys
+	// choose their categories freely.
+	MetricsCategories []string
+	// Locks lists the locks managed by lockd. If empty, lockd manages a
+	// single lock whose hardware is configured by Hardware.
+	Locks []LockConfig
+}
+
+// LockConfig configures one of several locks managed by lockd.
+type LockConfig struct {
+	// Name identifies the lock within lockd. The state of the lock (e.g.
+	// whether it has been claimed, and its credentials) is stored in the
+	// directory LockDir(<configuration directory>, Name). It is unrelated to
+	// the name the lock is given when claimed.
+	Name string
+	// Hardware configures the hardware that manipulates the lock. Settings
+	// that are not set take their values from Config.Hardware.
+	Hardware HardwareConfig
+}
+
+// HardwareConfig configures the hardware that manipulates the lock.
+type HardwareConfig struct {
+	// Backend is the name of the implementation of Hardware to use (see
+	// Backends). DefaultBackend is used if empty. The --hardware flag, if
+	// set, takes precedence.
+	Backend string
+	// GPIOChip is the path of the Linux GPIO character device (e.g.
+	// "/dev/gpiochip0") used by the "gpiochip" backend, for which the number
+	// in RelayPin and MonitorPin is the offset of a line on that chip.
+	GPIOChip string
+	// RelayPin is the GPIO pin (e.g. "GPIO17") that drives the relay that
+	// locks and unlocks the lock.
+	RelayPin string
+	// MonitorPin is the GPIO pin (e.g. "GPIO22") that senses whether the
+	// lock is locked or unlocked.
+	MonitorPin string
+	// ToggleWait is the time after which an attempt to change the state of
+	// the lock is abandoned if the monitor pin has not reflected the change.
+	ToggleWait Duration
+	// PollInterval is the interval at which the monitor pin is read while
+	// changing the state of the lock, and at which the state of the lock is
+	// read otherwise, to notice it being operated by hand. Changes to both
+	// apply as soon as lockd reloads its configuration on SIGHUP.
+	PollInterval Duration
+	// SimulatedFailureRate is the fraction, in [0, 1), of the attempts to
+	// change the state of a simulated lock that fail at random.
+	SimulatedFailureRate float64
+	// SimulatedControlSocket, if set, is the path of a unix domain socket on
+	// which the "simulated" backend accepts commands that manipulate the
+	// simulated lock (e.g. to jam it, or to fail the next attempt to change
+	// its state).
+	SimulatedControlSocket string
+	// ScenarioFile is the path of the file containing the Scenario replayed
+	// by the "scenario" backend.
+	ScenarioFile string
+	// Motor configures the "servo" and "hbridge" backends, which move the
+	// bolt with a motor rather than a relay.
+	Motor MotorConfig
+	// Strike configures the "strike" and "simulated-strike" backends, for
+	// electric strikes and solenoids that are energised briefly to unlock.
+	Strike StrikeConfig
+	// Keypad configures the keypad on which PINs are entered to unlock the
+	// lock, if any.
+	Keypad KeypadConfig
+	// Tamper configures the detection of attempts to tamper with the lock.
+	Tamper TamperConfig
+	// Power configures the sensing of the battery that powers the lock.
+	Power PowerConfig
+	// Lockout configures the protection of the lock against callers that
+	// repeatedly fail to claim, lock or unlock it.
+	Lockout LockoutConfig
+	// TwoPerson configures the two-person rule for unlocking the lock.
+	TwoPerson TwoPersonConfig
+	// Approval configures the unlocks that require the approval of the
+	// owner of the lock.
+	Approval ApprovalConfig
+	// StartupPolicy determines what lockd does when it starts and finds the
+	// lock in a state other than the one it was being commanded to, if the
+	// command was interrupted by lockd stopping, or else the one it was last
+	// observed in: "alert" to raise an alarm, or "restore" to command the
+	// lock to that state again.
+	StartupPolicy string
+	// RecordFile, if set, is the path of a file to which the "rpi" backend
+	// records the behaviour of the monitor pin, a line for every change,
+	// which can then be replayed as a Scenario with the "scenario" backend.
+	RecordFile string
+}
+
+// MotorConfig configures the "servo" and "hbridge" backends.
+type MotorConfig struct {
+	// PWMChip is the sysfs directory of the PWM chip (e.g.
+	// "/sys/class/pwm/pwmchip0") that drives the servo of the "servo"
+	// backend, and PWMChannel the channel of that chip that is used.
+	PWMChip    string
+	PWMChannel int
+	// PWMPeriod is the period of the PWM signal sent to the servo.
+	PWMPeriod Duration
+	// LockedPulse and UnlockedPulse are the widths of the pulses that move
+	// the servo to the locked and unlocked positions respectively.
+	LockedPulse   Duration
+	UnlockedPulse Duration
+	// ForwardPin and ReversePin are the GPIO pins (e.g. "GPIO23") connected
+	// to the inputs of the H-bridge of the "hbridge" backend. The motor
+	// moves the bolt towards the unlocked position while ForwardPin is high,
+	// and towards the locked position while ReversePin is high.
+	ForwardPin string
+	ReversePin string
+	// TravelTime is the time for which the motor is driven to move the bolt
+	// from one position to the other.
+	TravelTime Duration
+	// PositionPin, if set, is a GPIO pin that is high when the bolt is in
+	// the unlocked position and low otherwise. Without it, the lock is
+	// assumed to be in the state it was last moved to, or when lockd
+	// starts, the state it was last observed in before lockd stopped.
+	PositionPin string
+	// HomeOnStart, if set and there is no PositionPin, makes lockd move
+	// the bolt to the locked position when it starts, so that its position
+	// is known.
+	HomeOnStart bool
+	// Retries is the number of times the bolt is moved back and driven
+	// towards its target again when PositionPin shows that it did not reach
+	// it.
+	Retries int
+}
+
+// StrikeConfig configures the "strike" and "simulated-strike" backends.
+//
+// An electric strike lets the door open while it is energised, and holds it
+// shut otherwise. Unlocking energises it until the door opens or Pulse
+// elapses, whichever comes first, after which the lock is locked again.
+type StrikeConfig struct {
+	// StrikePin is the GPIO pin (e.g. "GPIO17") that energises the strike
+	// while high.
+	StrikePin string
+	// DoorPin, if set, is a GPIO pin that is high while the door is open.
+	// Without it, the strike is energised for the whole Pulse.
+	DoorPin string
+	// Pulse is the maximum time for which the strike is energised when the
+	// lock is unlocked.
+	Pulse Duration
+}
+
+// KeypadConfig configures the keypad of a lock.
+type KeypadConfig struct {
+	// Type is the kind of keypad: empty if the lock has none, "matrix" for a
+	// matrix keypad connected to GPIO pins, or "stdin" to read PINs, one per
+	// line, from the standard input (e.g. along with simulated hardware).
+	Type string
+	// RowPins and ColumnPins are the GPIO pins connected to the rows and
+	// columns of a "matrix" keypad.
+	RowPins    []string
+	ColumnPins []string
+	// Keys lists the keys of each row of a "matrix" keypad, e.g. "123A".
+	// The digits make up PINs, '*' clears the keys entered so far and '#'
+	// completes a PIN. Other keys are ignored.
+	Keys []string
+	// EntryTimeout is the time of inactivity after which the keys entered so
+	// far on a "matrix" keypad are cleared.
+	EntryTimeout Duration
+	// AlarmAfter, if positive, is the number of consecutive wrong PINs after
+	// which an alarm is raised, and raised again. Wrong PINs also count
+	// towards locking out the keypad as configured by Lockout, and make the
+	// keypad refuse the PINs entered in the following seconds.
+	AlarmAfter int
+}
+
+// TamperConfig configures the detection of attempts to tamper with a lock,
+// which raise alarms.
+type TamperConfig struct {
+	// EnclosurePin, if set, is a GPIO pin that is high while the enclosure
+	// of the lock device is open. Opening the enclosure raises an alarm.
+	EnclosurePin string
+	// ForcedBolt makes the lock being unlocked while lockd did not unlock it
+	// raise an alarm. It is not meant for locks that are routinely unlocked
+	// by hand, e.g. with a thumbturn on the inside of the door.
+	ForcedBolt bool
+	// Buzz, if positive, is the time for which the relay is energised when
+	// an alarm is raised, for circuitry in which RelayPin drives a buzzer.
+	// It is ignored by backends without a relay.
+	Buzz Duration
+}
+
+// PowerConfig configures the sensing of the battery that powers a lock.
+//
+// The battery is sensed through an ADC if one is configured, and otherwise
+// by the hardware backend if it can (e.g. "simulated").
+type PowerConfig struct {
+	// ADC, if set, is the sysfs path of the channel of an IIO ADC that
+	// measures the voltage of the battery, without the "_raw" and "_scale"
+	// suffixes (e.g. "/sys/bus/iio/devices/iio:device0/in_voltage0").
+	ADC string
+	// Divider is the ratio of the voltage of the battery to the voltage
+	// measured by the ADC, for batteries connected through a voltage divider.
+	Divider float64
+	// EmptyVoltage and FullVoltage are the voltages, in volts, of an empty
+	// and of a fully charged battery. The level of the battery is assumed to
+	// be linear in between.
+	EmptyVoltage float64
+	FullVoltage  float64
+	// LowLevel is the level of the battery, as a fraction of its capacity,
+	// below which lockd warns that it must be replaced.
+	LowLevel float64
+	// MinLevel, if positive, is the level of the battery below which lockd
+	// refuses to lock or unlock, rather than risk the bolt stalling halfway.
+	MinLevel float64
+	// CheckInterval is the interval at which the level of the battery is
+	// checked.
+	CheckInterval Duration
+}
+
+// LockoutConfig configures the protection of a lock against callers that
+// repeatedly fail to claim, lock or unlock it, e.g. to guess their way in. It
+// also applies to the wrong PINs entered on the keypad of the lock, as if the
+// keypad were a caller.
+//
+// Callers are identified by their public key, and the attempts of at most
+// 1000 callers are tracked at a time. A caller that uses a fresh key for
+// every attempt is therefore neither locked out nor rate limited.
+type LockoutConfig struct {
+	// MaxFailures is the number of failed attempts by a caller within Window
+	// after which the caller is locked out, i.e. its attempts are refused
+	// without being tried, for Duration. Callers are never locked out if it
+	// is zero.
+	MaxFailures int
+	Window      Duration
+	Duration    Duration
+	// MinInterval, if positive, is the minimum time between two attempts by
+	// a caller to claim, lock or unlock the lock. Attempts made sooner are
+	// refused without being tried. It is zero by default, since it also
+	// applies to the owner of the lock.
+	MinInterval Duration
+}
+
+// TwoPersonConfig configures the two-person rule for unlocking a lock, for
+// sensitive doors: a call to Unlock merely requests the lock to be unlocked,
+// which it is only once a second caller, with a different key and blessing
+// names that neither equal nor extend those of the first (or the other way
+// round), calls Unlock within Window. Since every key extends the key of the
+// owner, the owner cannot be either of the two callers.
+type TwoPersonConfig struct {
+	// Enabled makes the two-person rule apply to the lock. PINs entered on
+	// the keypad of the lock are not subject to it.
+	Enabled bool
+	Window  Duration
+}
+
+// ApprovalConfig configures the unlocks that require the approval of the
+// owner of a lock, which lockd requests from the client of the owner (see
+// "lock agent") every time such an unlock is attempted.
+type ApprovalConfig struct {
+	// Categories lists the categories of keys (e.g. "contractor" for the key
+	// <lock>:key:contractor) whose unlocks require approval.
+	Categories []string
+	// Timeout is the time after which an unlock that has been neither
+	// approved nor denied is refused.
+	Timeout Duration
+}
+
+// Duration is a time.Duration that is JSON encoded as a string understood by
+// time.ParseDuration, e.g. "1m30s".
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// DefaultConfig returns the configuration used in the absence of a
+// configuration file.
+func DefaultConfig() Config {
+	return Config{
+		Version: ConfigVersion,
+		Hardware: HardwareConfig{
+			GPIOChip:      "/dev/gpiochip0",
+			RelayPin:      "GPIO17",
+			MonitorPin:    "GPIO22",
+			ToggleWait:    Duration{5 * time.Second},
+			PollInterval:  Duration{200 * time.Millisecond},
+			StartupPolicy: "alert",
+			Motor: MotorConfig{
+				PWMChip:       "/sys/class/pwm/pwmchip0",
+				PWMPeriod:     Duration{20 * time.Millisecond},
+				LockedPulse:   Duration{1 * time.Millisecond},
+				UnlockedPulse: Duration{2 * time.Millisecond},
+				ForwardPin:    "GPIO23",
+				ReversePin:    "GPIO24",
+				TravelTime:    Duration{time.Second},
+				Retries:       2,
+			},
+			Strike: StrikeConfig{
+				StrikePin: "GPIO17",
+				Pulse:     Duration{5 * time.Second},
+			},
+			Keypad: KeypadConfig{
+				RowPins:      []string{"GPIO5", "GPIO6", "GPIO13", "GPIO19"},
+				ColumnPins:   []string{"GPIO12", "GPIO16", "GPIO20", "GPIO21"},
+				Keys:         []string{"123A", "456B", "789C", "*0#D"},
+				EntryTimeout: Duration{10 * time.Second},
+				AlarmAfter:   10,
+			},
+			Lockout: LockoutConfig{
+				MaxFailures: 5,
+				Window:      Duration{10 * time.Minute},
+				Duration:    Duration{15 * time.Minute},
+			},
+			TwoPerson: TwoPersonConfig{
+				Window: Duration{2 * time.Minute},
+			},
+			Approval: ApprovalConfig{
+				Timeout: Duration{30 * time.Second},
+			},
+			Power: PowerConfig{
+				Divider:       1,
+				EmptyVoltage:  4.4,
+				FullVoltage:   6.4,
+				LowLevel:      0.2,
+				CheckInterval: Duration{time.Minute},
+			},
+		},
+	}
+}
+
+// LoadConfig reads and validates the configuration file in configDir. If the
+// file does not exist, DefaultConfig is returned.
+func LoadConfig(configDir string) (Config, error) {
+	cfg := DefaultConfig()
+	path := filepath.Join(configDir, ConfigFile)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	// Fields absent from the file retain their default values. The version
+	// must however be stated explicitly.
+	cfg.Version = 0
+	// The hardware settings of each lock default to those in
+	// Config.Hardware, so they are decoded once the latter are known.
+	file := struct {
+		Config
+		Locks []json.RawMessage
+	}{Config: cfg}
+	if err := decodeJSON(f, &file); err != nil {
+		return Config{}, fmt.Errorf("could not parse %v: %v", path, err)
+	}
+	cfg = file.Config
+	for i, raw := range file.Locks {
+		// Decoding into a slice reuses its array, which must therefore not
+		// be shared with cfg.Hardware.
+		l := LockConfig{Hardware: cfg.Hardware.copy()}
+		if err := decodeJSON(bytes.NewReader(raw), &l); err != nil {
+			return Config{}, fmt.Errorf("could not parse Locks[%d] in %v: %v", i, path, err)
+		}
+		cfg.Locks = append(cfg.Locks, l)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration in %v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// copy returns a copy of cfg that shares no slices with cfg.
+func (cfg HardwareConfig) copy() HardwareConfig {
+	cfg.Keypad.RowPins = append([]string(nil), cfg.Keypad.RowPins...)
+	cfg.Keypad.ColumnPins = append([]string(nil), cfg.Keypad.ColumnPins...)
+	cfg.Keypad.Keys = append([]string(nil), cfg.Keypad.Keys...)
+	cfg.Approval.Categories = append([]string(nil), cfg.Approval.Categories...)
+	return cfg
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg Config) Validate() error {
+	if cfg.Version != ConfigVersion {
+		return fmt.Errorf("unsupported Version %d, this lockd understands version %d", cfg.Version, ConfigVersion)
+	}
+	if err := cfg.Hardware.Validate(); err != nil {
+		return err
+	}
+	for _, c := range cfg.MetricsCategories {
+		if len(c) == 0 || strings.Contains(c, ":") {
+			return fmt.Errorf("MetricsCategories contains %q, which is not a valid key category", c)
+		}
+	}
+	names := make(map[string]bool)
+	for i, l := range cfg.Locks {
+		if !lockNameRE.MatchString(l.Name) {
+			return fmt.Errorf("Locks[%d].Name=%q must consist of letters, digits, '-' and '_' and not start with '-' or '_'", i, l.Name)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("Locks[%d].Name=%q is not unique", i, l.Name)
+		}
+		names[l.Name] = true
+		if err := l.Hardware.Validate(); err != nil {
+			return fmt.Errorf("Locks[%d] (%v): %v", i, l.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg HardwareConfig) Validate() error {
+	if len(cfg.Backend) > 0 && !isRegistered(cfg.Backend) {
+		return fmt.Errorf("Hardware.Backend=%q is not one of: %v", cfg.Backend, strings.Join(Backends(), ", "))
+	}
+	for _, pin := range []struct{ field, value string }{
+		{"RelayPin", cfg.RelayPin},
+		{"MonitorPin", cfg.MonitorPin},
+	} {
+		if !gpioPinRE.MatchString(pin.value) {
+			return fmt.Errorf("Hardware.%v=%q is not of the form GPIO<number>", pin.field, pin.value)
+		}
+	}
+	if cfg.RelayPin == cfg.MonitorPin {
+		return fmt.Errorf("Hardware.RelayPin and Hardware.MonitorPin must be different pins, both are %v", cfg.RelayPin)
+	}
+	if cfg.ToggleWait.Duration <= 0 {
+		return fmt.Errorf("Hardware.ToggleWait=%v must be positive", cfg.ToggleWait)
+	}
+	if cfg.PollInterval.Duration <= 0 || cfg.PollInterval.Duration > cfg.ToggleWait.Duration {
+		return fmt.Errorf("Hardware.PollInterval=%v must be positive and no more than Hardware.ToggleWait=%v", cfg.PollInterval, cfg.ToggleWait)
+	}
+	if cfg.StartupPolicy != "alert" && cfg.StartupPolicy != "restore" {
+		return fmt.Errorf("Hardware.StartupPolicy=%q must be \"alert\" or \"restore\"", cfg.StartupPolicy)
+	}
+	if cfg.SimulatedFailureRate < 0 || cfg.SimulatedFailureRate >= 1 {
+		return fmt.Errorf("Hardware.SimulatedFailureRate=%v must be in [0, 1)", cfg.SimulatedFailureRate)
+	}
+	if err := cfg.Motor.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Strike.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Keypad.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Tamper.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Lockout.Validate(); err != nil {
+		return err
+	}
+	if cfg.TwoPerson.Enabled && cfg.TwoPerson.Window.Duration <= 0 {
+		return fmt.Errorf("Hardware.TwoPerson.Window=%v must be positive", cfg.TwoPerson.Window)
+	}
+	if err := cfg.Approval.Validate(); err != nil {
+		return err
+	}
+	return cfg.Power.Validate()
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg ApprovalConfig) Validate() error {
+	for _, c := range cfg.Categories {
+		if len(c) == 0 || strings.Contains(c, ":") {
+			return fmt.Errorf("Hardware.Approval.Categories contains %q, which is not a valid key category", c)
+		}
+	}
+	if len(cfg.Categories) > 0 && cfg.Timeout.Duration <= 0 {
+		return fmt.Errorf("Hardware.Approval.Timeout=%v must be positive", cfg.Timeout)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg LockoutConfig) Validate() error {
+	if cfg.MaxFailures < 0 {
+		return fmt.Errorf("Hardware.Lockout.MaxFailures=%d must not be negative", cfg.MaxFailures)
+	}
+	if cfg.MaxFailures > 0 && (cfg.Window.Duration <= 0 || cfg.Duration.Duration <= 0) {
+		return fmt.Errorf("Hardware.Lockout.Window=%v and Hardware.Lockout.Duration=%v must be positive", cfg.Window, cfg.Duration)
+	}
+	if cfg.MinInterval.Duration < 0 {
+		return fmt.Errorf("Hardware.Lockout.MinInterval=%v must not be negative", cfg.MinInterval)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg PowerConfig) Validate() error {
+	if cfg.Divider <= 0 {
+		return fmt.Errorf("Hardware.Power.Divider=%v must be positive", cfg.Divider)
+	}
+	if cfg.EmptyVoltage < 0 || cfg.FullVoltage <= cfg.EmptyVoltage {
+		return fmt.Errorf("Hardware.Power.EmptyVoltage=%v must not be negative, and must be less than Hardware.Power.FullVoltage=%v", cfg.EmptyVoltage, cfg.FullVoltage)
+	}
+	if cfg.LowLevel < 0 || cfg.LowLevel > 1 {
+		return fmt.Errorf("Hardware.Power.LowLevel=%v must be in [0, 1]", cfg.LowLevel)
+	}
+	if cfg.MinLevel < 0 || cfg.MinLevel > cfg.LowLevel {
+		return fmt.Errorf("Hardware.Power.MinLevel=%v must not be negative, and must be no more than Hardware.Power.LowLevel=%v", cfg.MinLevel, cfg.LowLevel)
+	}
+	if cfg.CheckInterval.Duration <= 0 {
+		return fmt.Errorf("Hardware.Power.CheckInterval=%v must be positive", cfg.CheckInterval)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg TamperConfig) Validate() error {
+	if len(cfg.EnclosurePin) > 0 && !gpioPinRE.MatchString(cfg.EnclosurePin) {
+		return fmt.Errorf("Hardware.Tamper.EnclosurePin=%q is not of the form GPIO<number>", cfg.EnclosurePin)
+	}
+	if cfg.Buzz.Duration < 0 {
+		return fmt.Errorf("Hardware.Tamper.Buzz=%v must not be negative", cfg.Buzz)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg KeypadConfig) Validate() error {
+	if cfg.AlarmAfter < 0 {
+		return fmt.Errorf("Hardware.Keypad.AlarmAfter=%d must not be negative", cfg.AlarmAfter)
+	}
+	switch cfg.Type {
+	case "", "stdin":
+		return nil
+	case "matrix":
+	default:
+		return fmt.Errorf("Hardware.Keypad.Type=%q must be empty, \"matrix\" or \"stdin\"", cfg.Type)
+	}
+	for _, pins := range []struct {
+		field  string
+		values []string
+	}{
+		{"RowPins", cfg.RowPins},
+		{"ColumnPins", cfg.ColumnPins},
+	} {
+		if len(pins.values) == 0 {
+			return fmt.Errorf("Hardware.Keypad.%v must not be empty", pins.field)
+		}
+		for _, pin := range pins.values {
+			if !gpioPinRE.MatchString(pin) {
+				return fmt.Errorf("Hardware.Keypad.%v contains %q, which is not of the form GPIO<number>", pins.field, pin)
+			}
+		}
+	}
+	if len(cfg.Keys) != len(cfg.RowPins) {
+		return fmt.Errorf("Hardware.Keypad.Keys must have one entry per row, i.e. %d entries", len(cfg.RowPins))
+	}
+	for i, row := range cfg.Keys {
+		if len(row) != len(cfg.ColumnPins) {
+			return fmt.Errorf("Hardware.Keypad.Keys[%d]=%q must have one key per column, i.e. %d keys", i, row, len(cfg.ColumnPins))
+		}
+	}
+	if cfg.EntryTimeout.Duration <= 0 {
+		return fmt.Errorf("Hardware.Keypad.EntryTimeout=%v must be positive", cfg.EntryTimeout)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg StrikeConfig) Validate() error {
+	if !gpioPinRE.MatchString(cfg.StrikePin) {
+		return fmt.Errorf("Hardware.Strike.StrikePin=%q is not of the form GPIO<number>", cfg.StrikePin)
+	}
+	if len(cfg.DoorPin) > 0 && !gpioPinRE.MatchString(cfg.DoorPin) {
+		return fmt.Errorf("Hardware.Strike.DoorPin=%q is not of the form GPIO<number>", cfg.DoorPin)
+	}
+	if cfg.StrikePin == cfg.DoorPin {
+		return fmt.Errorf("Hardware.Strike.StrikePin and Hardware.Strike.DoorPin must be different pins, both are %v", cfg.StrikePin)
+	}
+	if cfg.Pulse.Duration <= 0 {
+		return fmt.Errorf("Hardware.Strike.Pulse=%v must be positive", cfg.Pulse)
+	}
+	return nil
+}
+
+// Validate returns an error describing the first problem found with cfg, or
+// nil if there is none.
+func (cfg MotorConfig) Validate() error {
+	if cfg.PWMChannel < 0 {
+		return fmt.Errorf("Hardware.Motor.PWMChannel=%d must not be negative", cfg.PWMChannel)
+	}
+	if cfg.PWMPeriod.Duration <= 0 {
+		return fmt.Errorf("Hardware.Motor.PWMPeriod=%v must be positive", cfg.PWMPeriod)
+	}
+	for _, pulse := range []struct {
+		field string
+		value Duration
+	}{
+		{"LockedPulse", cfg.LockedPulse},
+		{"UnlockedPulse", cfg.UnlockedPulse},
+	} {
+		if pulse.value.Duration <= 0 || pulse.value.Duration >= cfg.PWMPeriod.Duration {
+			return fmt.Errorf("Hardware.Motor.%v=%v must be positive and less than Hardware.Motor.PWMPeriod=%v", pulse.field, pulse.value, cfg.PWMPeriod)
+		}
+	}
+	for _, pin := range []struct{ field, value string }{
+		{"ForwardPin", cfg.ForwardPin},
+		{"ReversePin", cfg.ReversePin},
+		{"PositionPin", cfg.PositionPin},
+	} {
+		if pin.field == "PositionPin" && len(pin.value) == 0 {
+			continue
+		}
+		if !gpioPinRE.MatchString(pin.value) {
+			return fmt.Errorf("Hardware.Motor.%v=%q is not of the form GPIO<number>", pin.field, pin.value)
+		}
+	}
+	if cfg.ForwardPin == cfg.ReversePin || cfg.ForwardPin == cfg.PositionPin || cfg.ReversePin == cfg.PositionPin {
+		return fmt.Errorf("Hardware.Motor.ForwardPin, ReversePin and PositionPin must be different pins")
+	}
+	if cfg.TravelTime.Duration <= 0 {
+		return fmt.Errorf("Hardware.Motor.TravelTime=%v must be positive", cfg.TravelTime)
+	}
+	if cfg.Retries < 0 {
+		return fmt.Errorf("Hardware.Motor.Retries=%d must not be negative", cfg.Retries)
+	}
+	return nil
+}
+
+// checkSamePins returns an error if the GPIO pins configured in to differ from
+// those in from, as hardware cannot switch pins without being restarted.
+func checkSamePins(from, to HardwareConfig) error {
+	if from.GPIOChip != to.GPIOChip || from.RelayPin != to.RelayPin || from.MonitorPin != to.MonitorPin {
+		return fmt.Errorf("cannot change the GPIO pins from (chip: %q, relay: %v, monitor: %v) to (chip: %q, relay: %v, monitor: %v) without restarting", from.GPIOChip, from.RelayPin, from.MonitorPin, to.GPIOChip, to.RelayPin, to.MonitorPin)
+	}
+	return nil
+}
+
+// gpioPin returns the number of a GPIO pin named as in HardwareConfig.
+func gpioPin(name string) int {
+	n, _ := strconv.Atoi(gpioPinRE.FindStringSubmatch(name)[1])
+	return n
+}
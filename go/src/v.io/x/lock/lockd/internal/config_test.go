@@ -0,0 +1,132 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadConfig writes contents to a configuration file in a temporary directory
+// and loads it.
+func loadConfig(t *testing.T, contents string) (Config, error) {
+	dir, err := ioutil.TempDir("", "lockd-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, ConfigFile), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(dir)
+}
+
+func TestLoadConfigLocksDoNotShareDefaults(t *testing.T) {
+	cfg, err := loadConfig(t, `{
+  "Version": 1,
+  "Locks": [
+    {
+      "Name": "front",
+      "Hardware": {
+        "Keypad": {
+          "Type": "matrix",
+          "RowPins": ["GPIO1", "GPIO2", "GPIO3", "GPIO4"],
+          "Keys": ["ABCD", "EFGH", "IJKL", "MNOP"]
+        },
+        "Approval": {"Categories": ["contractor"]}
+      }
+    },
+    {"Name": "back"}
+  ]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := DefaultConfig().Hardware
+	if got, want := cfg.Locks[0].Hardware.Keypad.RowPins, []string{"GPIO1", "GPIO2", "GPIO3", "GPIO4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got RowPins %v for the first lock, want %v", got, want)
+	}
+	for _, hw := range []HardwareConfig{cfg.Hardware, cfg.Locks[1].Hardware} {
+		if !reflect.DeepEqual(hw.Keypad, defaults.Keypad) {
+			t.Errorf("got keypad %+v, want the default %+v", hw.Keypad, defaults.Keypad)
+		}
+		if len(hw.Approval.Categories) != 0 {
+			t.Errorf("got approval categories %v, want none", hw.Approval.Categories)
+		}
+	}
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockd-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultConfig(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v without a configuration file, want the default %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		contents string
+		// want are substrings of the expected error.
+		want []string
+	}{
+		{`{}`, []string{"invalid configuration in", ConfigFile, "unsupported Version 0, this lockd understands version 1"}},
+		{`{"Version": 1, "Bogus": true}`, []string{"could not parse", ConfigFile, `unknown field "Bogus"`}},
+		{`{"Version": 1, "Hardware": {"ToggleWait": "soon"}}`, []string{"could not parse", `time: invalid duration`}},
+		{`{"Version": 1, "Hardware": {"ToggleWait": 5}}`, []string{"could not parse", `duration must be a string such as "5s"`}},
+		{`{"Version": 1, "Hardware": {"RelayPin": "17"}}`, []string{`Hardware.RelayPin="17" is not of the form GPIO<number>`}},
+		{`{"Version": 1, "Hardware": {"MonitorPin": "GPIO17"}}`, []string{"Hardware.RelayPin and Hardware.MonitorPin must be different pins, both are GPIO17"}},
+		{`{"Version": 1, "Hardware": {"ToggleWait": "0s"}}`, []string{"Hardware.ToggleWait=0s must be positive"}},
+		{`{"Version": 1, "Hardware": {"PollInterval": "10s"}}`, []string{"Hardware.PollInterval=10s must be positive and no more than Hardware.ToggleWait=5s"}},
+		{`{"Version": 1, "Hardware": {"StartupPolicy": "ignore"}}`, []string{`Hardware.StartupPolicy="ignore" must be "alert" or "restore"`}},
+		{`{"Version": 1, "Hardware": {"SimulatedFailureRate": 1}}`, []string{"Hardware.SimulatedFailureRate=1 must be in [0, 1)"}},
+		{`{"Version": 1, "MetricsCategories": ["friend:guest"]}`, []string{`MetricsCategories contains "friend:guest", which is not a valid key category`}},
+		{`{"Version": 1, "Locks": [{"Name": "front", "Hardware": {"Bogus": true}}]}`, []string{"could not parse Locks[0] in", `unknown field "Bogus"`}},
+		{`{"Version": 1, "Locks": [{"Name": "-front"}]}`, []string{`Locks[0].Name="-front" must consist of letters, digits, '-' and '_'`}},
+		{`{"Version": 1, "Locks": [{"Name": "front"}, {"Name": "front"}]}`, []string{`Locks[1].Name="front" is not unique`}},
+		{
+			`{"Version": 1, "Locks": [{"Name": "front"}, {"Name": "back", "Hardware": {"StartupPolicy": "ignore"}}]}`,
+			[]string{`Locks[1] (back): Hardware.StartupPolicy="ignore" must be "alert" or "restore"`},
+		},
+	}
+	for _, test := range tests {
+		cfg, err := loadConfig(t, test.contents)
+		if err == nil {
+			t.Errorf("%s: got %+v, want an error", test.contents, cfg)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got error %q, want it to contain %q", test.contents, err, want)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("default configuration invalid: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.Hardware.PollInterval = cfg.Hardware.ToggleWait
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("PollInterval equal to ToggleWait invalid: %v", err)
+	}
+	cfg.Hardware.Backend = "bogus"
+	if err := cfg.Validate(); err == nil || !strings.HasPrefix(err.Error(), `Hardware.Backend="bogus" is not one of: `) {
+		t.Errorf("got error %v for an unknown backend", err)
+	}
+}
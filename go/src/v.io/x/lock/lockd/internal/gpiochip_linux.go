@@ -0,0 +1,196 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The types and constants below mirror version 2 of the GPIO character device
+// userspace API, defined in <linux/gpio.h>.
+
+const (
+	gpioV2LinesMax        = 64
+	gpioMaxNameSize       = 32
+	gpioV2LineNumAttrsMax = 10
+
+	gpioV2LineFlagInput       = 1 << 2
+	gpioV2LineFlagOutput      = 1 << 3
+	gpioV2LineFlagEdgeRising  = 1 << 4
+	gpioV2LineFlagEdgeFalling = 1 << 5
+
+	gpioV2LineAttrIDOutputValues = 2
+
+	gpioV2GetLineIoctl       = 0xc250b407
+	gpioV2LineGetValuesIoctl = 0xc010b40e
+	gpioV2LineSetValuesIoctl = 0xc010b40f
+	gpioV2LineEventSize      = 48
+	gpioConsumer             = "lockd"
+)
+
+type gpioV2LineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   uint64 // flags, values or debounce_period_us depending on ID.
+}
+
+type gpioV2LineConfigAttribute struct {
+	Attr gpioV2LineAttribute
+	Mask uint64
+}
+
+type gpioV2LineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [gpioV2LineNumAttrsMax]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	Offsets         [gpioV2LinesMax]uint32
+	Consumer        [gpioMaxNameSize]byte
+	Config          gpioV2LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+type gpioV2LineValues struct {
+	Bits uint64
+	Mask uint64
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// kernelGPIOChip is a gpioChip backed by a GPIO character device.
+type kernelGPIOChip struct {
+	f *os.File
+}
+
+func openGPIOChip(path string) (gpioChip, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &kernelGPIOChip{f: f}, nil
+}
+
+// requestLine requests the line at offset with the provided configuration
+// and returns the file descriptor of the line request.
+func (c *kernelGPIOChip) requestLine(offset int, config gpioV2LineConfig) (*os.File, error) {
+	var req gpioV2LineRequest
+	req.Offsets[0] = uint32(offset)
+	req.NumLines = 1
+	req.Config = config
+	copy(req.Consumer[:], gpioConsumer)
+	if err := ioctl(c.f.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to request line %d: %v", offset, err)
+	}
+	// Make the line non-blocking so that reads of edge events can be
+	// given a deadline.
+	if err := syscall.SetNonblock(int(req.Fd), true); err != nil {
+		syscall.Close(int(req.Fd))
+		return nil, err
+	}
+	return os.NewFile(uintptr(req.Fd), fmt.Sprintf("%v:%d", c.f.Name(), offset)), nil
+}
+
+func (c *kernelGPIOChip) RequestOutput(offset int, value bool) (gpioOutputLine, error) {
+	config := gpioV2LineConfig{Flags: gpioV2LineFlagOutput, NumAttrs: 1}
+	config.Attrs[0] = gpioV2LineConfigAttribute{
+		Attr: gpioV2LineAttribute{ID: gpioV2LineAttrIDOutputValues, Value: boolBit(value)},
+		Mask: 1,
+	}
+	f, err := c.requestLine(offset, config)
+	if err != nil {
+		return nil, err
+	}
+	return &kernelGPIOLine{f: f}, nil
+}
+
+func (c *kernelGPIOChip) RequestInput(offset int) (gpioInputLine, error) {
+	f, err := c.requestLine(offset, gpioV2LineConfig{Flags: gpioV2LineFlagInput | gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling})
+	if err != nil {
+		return nil, err
+	}
+	return &kernelGPIOLine{f: f}, nil
+}
+
+func (c *kernelGPIOChip) Close() error {
+	return c.f.Close()
+}
+
+// kernelGPIOLine is a single line requested from a kernelGPIOChip, usable
+// both as a gpioOutputLine and a gpioInputLine depending on how it was
+// requested.
+type kernelGPIOLine struct {
+	f *os.File
+}
+
+// ioctl invokes the ioctl req on the line without changing the line's file
+// descriptor back to blocking mode (as os.File.Fd would).
+func (l *kernelGPIOLine) ioctl(req uintptr, arg unsafe.Pointer) error {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	if err := rc.Control(func(fd uintptr) { ioctlErr = ioctl(fd, req, arg) }); err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func (l *kernelGPIOLine) Set(value bool) error {
+	values := gpioV2LineValues{Bits: boolBit(value), Mask: 1}
+	return l.ioctl(gpioV2LineSetValuesIoctl, unsafe.Pointer(&values))
+}
+
+func (l *kernelGPIOLine) Get() (bool, error) {
+	values := gpioV2LineValues{Mask: 1}
+	if err := l.ioctl(gpioV2LineGetValuesIoctl, unsafe.Pointer(&values)); err != nil {
+		return false, err
+	}
+	return values.Bits&1 == 1, nil
+}
+
+func (l *kernelGPIOLine) WaitForEdge(timeout time.Duration) (bool, error) {
+	if err := l.f.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	// The contents of the event (which edge, and when) are not needed:
+	// callers read the value of the line afterwards.
+	var event [gpioV2LineEventSize]byte
+	if _, err := l.f.Read(event[:]); err != nil {
+		if os.IsTimeout(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *kernelGPIOLine) Close() error {
+	return l.f.Close()
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package internal
+
+import "errors"
+
+func openGPIOChip(path string) (gpioChip, error) {
+	return nil, errors.New("GPIO character devices are only supported on Linux")
+}
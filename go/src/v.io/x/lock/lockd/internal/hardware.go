@@ -4,18 +4,148 @@
 
 package internal
 
-import "v.io/x/lock"
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-var hardware Hardware // The single global instance of Hardware, initialized by init()
+	"v.io/x/lock"
+)
 
 // Hardware abstracts the interface for physically manipulating the lock.
+//
+// Hardware that must release resources when lockd stops implements io.Closer.
 type Hardware interface {
 	// Status returns the current state of the lock.
 	Status() lock.LockStatus
 
 	// SetStatus changes the state of the lock to the provided one.
 	SetStatus(s lock.LockStatus) error
+
+	// Info describes the hardware.
+	Info() Info
+}
+
+// Reconfigurable is implemented by Hardware whose configuration can be
+// changed while it is in use.
+type Reconfigurable interface {
+	// Reconfigure applies cfg to the hardware. It returns an error, and
+	// leaves the configuration unchanged, if cfg cannot be applied without
+	// re-creating the hardware (e.g., if it uses different GPIO pins).
+	Reconfigure(cfg HardwareConfig) error
+}
+
+// Buzzer is implemented by Hardware that can sound a buzzer, to draw
+// attention to the lock when an alarm is raised.
+type Buzzer interface {
+	// Buzz sounds the buzzer for d, and returns once it is silent again.
+	Buzz(d time.Duration)
+}
+
+// Unsensed is implemented by Hardware that may not be able to sense the state
+// of the lock, and reports the state it last moved the lock to instead.
+type Unsensed interface {
+	// AssumeStatus makes the hardware report status, e.g. the state saved
+	// before lockd last stopped, until the lock is moved. It returns false,
+	// and ignores status, if the hardware knows the state of the lock.
+	AssumeStatus(status lock.LockStatus) bool
+}
+
+// PowerSensor senses the level of the battery that powers the lock. It is
+// implemented by Hardware that can sense its own battery (see also
+// NewPowerSensor).
+type PowerSensor interface {
+	// BatteryLevel returns the remaining charge of the battery, as a
+	// fraction of its capacity.
+	BatteryLevel() (float64, error)
+}
+
+// Info describes an implementation of Hardware.
+type Info struct {
+	// Backend is the name of the implementation, e.g. "simulated" or "rpi".
+	Backend string
+	// Pins maps the function of each GPIO pin used (e.g. "relay") to the pin.
+	Pins map[string]string
+	// Relocks is true if the hardware locks by itself some time after being
+	// unlocked, as electric strikes do.
+	Relocks bool
+}
+
+// Backend creates a Hardware with the provided configuration.
+//
+// Any side effects of using an implementation of Hardware, such as opening
+// GPIO pins or installing signal handlers, must happen in its Backend rather
+// than when the Backend is registered.
+type Backend func(cfg HardwareConfig) (Hardware, error)
+
+var (
+	backendsMu sync.Mutex
+	backends   = make(map[string]Backend) // GUARDED_BY(backendsMu)
+)
+
+// RegisterBackend makes an implementation of Hardware available under the
+// provided name. It is meant to be called from init functions, and panics if
+// a backend has already been registered under name.
+func RegisterBackend(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, exists := backends[name]; exists {
+		panic(fmt.Sprintf("hardware backend %q registered twice", name))
+	}
+	backends[name] = b
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-// GetHardware returns the singleton instance of Hardware
-func GetHardware() Hardware { return hardware }
+// DefaultBackend returns the name of the backend used when none is
+// configured: "rpi" when running on ARM and "simulated" otherwise.
+func DefaultBackend() string {
+	if runtime.GOARCH == "arm" && isRegistered("rpi") {
+		return "rpi"
+	}
+	return "simulated"
+}
+
+func isRegistered(name string) bool {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	_, ok := backends[name]
+	return ok
+}
+
+// NewHardware creates a Hardware using the backend registered under name.
+func NewHardware(name string, cfg HardwareConfig) (Hardware, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	backendsMu.Lock()
+	b, ok := backends[name]
+	backendsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown hardware backend %q, must be one of: %v", name, strings.Join(Backends(), ", "))
+	}
+	return b(cfg)
+}
+
+// StuckError is returned by SetStatus when the lock did not reach the
+// requested state within the allotted time.
+type StuckError struct {
+	Waited time.Duration
+}
+
+func (e StuckError) Error() string {
+	return fmt.Sprintf("lock state unchanged after %v: might be stuck. aborting.", e.Waited)
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+func init() {
+	RegisterBackend("gpiochip", openGPIOChipHardware)
+}
+
+// gpioChip abstracts a GPIO chip exposed by the Linux kernel as a character
+// device (/dev/gpiochipN).
+//
+// All interactions with the kernel happen through this interface, so that a
+// fake chip can stand in for a real one when testing gpioChipHardware.
+type gpioChip interface {
+	// RequestOutput requests exclusive use of the line at offset as an
+	// output, initially driven to value.
+	RequestOutput(offset int, value bool) (gpioOutputLine, error)
+	// RequestInput requests exclusive use of the line at offset as an
+	// input that reports both rising and falling edges.
+	RequestInput(offset int) (gpioInputLine, error)
+	// Close releases the chip. Lines requested from it remain valid until
+	// they are closed.
+	Close() error
+}
+
+// gpioOutputLine is a line of a gpioChip requested as an output.
+type gpioOutputLine interface {
+	// Set drives the line to value.
+	Set(value bool) error
+	// Close releases the line.
+	Close() error
+}
+
+// gpioInputLine is a line of a gpioChip requested as an input.
+type gpioInputLine interface {
+	// Get returns the current value of the line.
+	Get() (bool, error)
+	// WaitForEdge blocks until the value of the line changes, or timeout
+	// elapses, and returns whether the value changed.
+	WaitForEdge(timeout time.Duration) (bool, error)
+	// Close releases the line.
+	Close() error
+}
+
+// gpioChipHardware is a Hardware that drives a relay and reads the state of
+// the lock from a monitor using two lines of a gpioChip. Unlike the "rpi"
+// hardware, it waits for edge events on the monitor instead of polling it.
+type gpioChipHardware struct {
+	relay   gpioOutputLine
+	monitor gpioInputLine
+	// info is fixed, as the lines cannot change without re-creating the
+	// hardware, so that Info does not wait for SetStatus to return.
+	info Info
+	mu   sync.Mutex     // To allow for only one SetStatus invocation at a time.
+	cfg  HardwareConfig // GUARDED_BY(mu)
+}
+
+func openGPIOChipHardware(cfg HardwareConfig) (Hardware, error) {
+	if len(cfg.GPIOChip) == 0 {
+		return nil, fmt.Errorf("Hardware.GPIOChip must be set to use GPIO character devices")
+	}
+	chip, err := openGPIOChip(cfg.GPIOChip)
+	if err != nil {
+		return nil, fmt.Errorf("could not open GPIO chip %v: %v", cfg.GPIOChip, err)
+	}
+	// The requested lines outlive the chip.
+	defer chip.Close()
+	hw, err := newGPIOChipHardware(chip, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return hw, nil
+}
+
+func newGPIOChipHardware(chip gpioChip, cfg HardwareConfig) (*gpioChipHardware, error) {
+	relay, err := chip.RequestOutput(gpioPin(cfg.RelayPin), false)
+	if err != nil {
+		return nil, fmt.Errorf("could not request relay line %v: %v", cfg.RelayPin, err)
+	}
+	monitor, err := chip.RequestInput(gpioPin(cfg.MonitorPin))
+	if err != nil {
+		relay.Close()
+		return nil, fmt.Errorf("could not request monitor line %v: %v", cfg.MonitorPin, err)
+	}
+	info := Info{
+		Backend: "gpiochip",
+		Pins: map[string]string{
+			"relay":   fmt.Sprintf("%v:%d", cfg.GPIOChip, gpioPin(cfg.RelayPin)),
+			"monitor": fmt.Sprintf("%v:%d", cfg.GPIOChip, gpioPin(cfg.MonitorPin)),
+		},
+	}
+	return &gpioChipHardware{relay: relay, monitor: monitor, info: info, cfg: cfg}, nil
+}
+
+func (hw *gpioChipHardware) Reconfigure(cfg HardwareConfig) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err := checkSamePins(hw.cfg, cfg); err != nil {
+		return err
+	}
+	hw.cfg = cfg
+	return nil
+}
+
+func (hw *gpioChipHardware) Status() lock.LockStatus {
+	unlocked, err := hw.monitor.Get()
+	if err != nil {
+		// Err on the side of not claiming that the door is secure.
+		vlog.Errorf("Failed to read monitor line: %v", err)
+		return lock.Unlocked
+	}
+	if unlocked {
+		return lock.Unlocked
+	}
+	return lock.Locked
+}
+
+func (hw *gpioChipHardware) Info() Info {
+	return hw.info
+}
+
+func (hw *gpioChipHardware) SetStatus(status lock.LockStatus) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	desired := (status == lock.Unlocked)
+	if err := hw.relay.Set(true); err != nil {
+		return err
+	}
+	defer hw.relay.Set(false)
+	start := time.Now()
+	for {
+		current, err := hw.monitor.Get()
+		if err != nil {
+			return err
+		}
+		if current == desired {
+			return nil
+		}
+		remaining := hw.cfg.ToggleWait.Duration - time.Since(start)
+		if remaining <= 0 {
+			return StuckError{Waited: time.Since(start)}
+		}
+		if _, err := hw.monitor.WaitForEdge(remaining); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"v.io/x/lock"
+)
+
+// fakeGPIOChip is a gpioChip whose lines are simulated in memory, so that
+// gpioChipHardware can be tested without a GPIO character device.
+type fakeGPIOChip struct {
+	mu      sync.Mutex
+	outputs map[int]*fakeGPIOOutputLine // GUARDED_BY(mu)
+	inputs  map[int]*fakeGPIOInputLine  // GUARDED_BY(mu)
+	closed  bool                        // GUARDED_BY(mu)
+}
+
+func newFakeGPIOChip() *fakeGPIOChip {
+	return &fakeGPIOChip{
+		outputs: make(map[int]*fakeGPIOOutputLine),
+		inputs:  make(map[int]*fakeGPIOInputLine),
+	}
+}
+
+func (c *fakeGPIOChip) RequestOutput(offset int, value bool) (gpioOutputLine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkFreeLocked(offset); err != nil {
+		return nil, err
+	}
+	l := &fakeGPIOOutputLine{value: value}
+	c.outputs[offset] = l
+	return l, nil
+}
+
+func (c *fakeGPIOChip) RequestInput(offset int) (gpioInputLine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkFreeLocked(offset); err != nil {
+		return nil, err
+	}
+	l := &fakeGPIOInputLine{edges: make(chan struct{}, 1)}
+	c.inputs[offset] = l
+	return l, nil
+}
+
+// REQUIRES: c.mu is held.
+func (c *fakeGPIOChip) checkFreeLocked(offset int) error {
+	if c.closed {
+		return fmt.Errorf("chip is closed")
+	}
+	if _, ok := c.outputs[offset]; ok {
+		return fmt.Errorf("line %d is busy", offset)
+	}
+	if _, ok := c.inputs[offset]; ok {
+		return fmt.Errorf("line %d is busy", offset)
+	}
+	return nil
+}
+
+func (c *fakeGPIOChip) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// fakeGPIOOutputLine records the values it is driven to. If onSet is set, it
+// is called with every value, e.g. to simulate the circuitry that the line
+// drives.
+type fakeGPIOOutputLine struct {
+	mu     sync.Mutex
+	value  bool       // GUARDED_BY(mu)
+	closed bool       // GUARDED_BY(mu)
+	onSet  func(bool) // GUARDED_BY(mu)
+}
+
+func (l *fakeGPIOOutputLine) Set(value bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return fmt.Errorf("line is closed")
+	}
+	l.value = value
+	if l.onSet != nil {
+		l.onSet(value)
+	}
+	return nil
+}
+
+func (l *fakeGPIOOutputLine) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+func (l *fakeGPIOOutputLine) get() (value, closed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.value, l.closed
+}
+
+// fakeGPIOInputLine is an input line whose value is set by the test.
+type fakeGPIOInputLine struct {
+	edges chan struct{}
+
+	mu     sync.Mutex
+	value  bool // GUARDED_BY(mu)
+	closed bool // GUARDED_BY(mu)
+}
+
+// set changes the value of the line, which reports an edge if it changed.
+func (l *fakeGPIOInputLine) set(value bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.value == value {
+		return
+	}
+	l.value = value
+	select {
+	case l.edges <- struct{}{}:
+	default:
+	}
+}
+
+func (l *fakeGPIOInputLine) Get() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false, fmt.Errorf("line is closed")
+	}
+	return l.value, nil
+}
+
+func (l *fakeGPIOInputLine) WaitForEdge(timeout time.Duration) (bool, error) {
+	select {
+	case <-l.edges:
+		return true, nil
+	case <-time.After(timeout):
+		return false, nil
+	}
+}
+
+func (l *fakeGPIOInputLine) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+func testGPIOChipConfig() HardwareConfig {
+	cfg := DefaultConfig().Hardware
+	cfg.RelayPin, cfg.MonitorPin = "GPIO17", "GPIO22"
+	cfg.ToggleWait = Duration{100 * time.Millisecond}
+	return cfg
+}
+
+func TestGPIOChipRequestsLines(t *testing.T) {
+	chip := newFakeGPIOChip()
+	if _, err := newGPIOChipHardware(chip, testGPIOChipConfig()); err != nil {
+		t.Fatal(err)
+	}
+	relay, ok := chip.outputs[17]
+	if !ok {
+		t.Fatalf("relay line 17 was not requested as an output, got outputs %v", chip.outputs)
+	}
+	if value, _ := relay.get(); value {
+		t.Errorf("relay line was requested driven high, want low")
+	}
+	if _, ok := chip.inputs[22]; !ok {
+		t.Errorf("monitor line 22 was not requested as an input, got inputs %v", chip.inputs)
+	}
+	if len(chip.outputs) != 1 || len(chip.inputs) != 1 {
+		t.Errorf("got %d outputs and %d inputs, want 1 of each", len(chip.outputs), len(chip.inputs))
+	}
+}
+
+func TestGPIOChipReleasesRelayOnError(t *testing.T) {
+	chip := newFakeGPIOChip()
+	// Make the monitor line busy.
+	if _, err := chip.RequestInput(22); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newGPIOChipHardware(chip, testGPIOChipConfig()); err == nil {
+		t.Fatal("newGPIOChipHardware succeeded with a busy monitor line")
+	}
+	if _, closed := chip.outputs[17].get(); !closed {
+		t.Errorf("relay line was not released")
+	}
+}
+
+func TestGPIOChipSetStatus(t *testing.T) {
+	chip := newFakeGPIOChip()
+	hw, err := newGPIOChipHardware(chip, testGPIOChipConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, monitor := chip.outputs[17], chip.inputs[22]
+	// Toggle the lock shortly after the relay is energized, as the circuitry
+	// would.
+	relay.onSet = func(value bool) {
+		if value {
+			time.AfterFunc(10*time.Millisecond, func() {
+				v, _ := monitor.Get()
+				monitor.set(!v)
+			})
+		}
+	}
+	for _, status := range []lock.LockStatus{lock.Unlocked, lock.Locked} {
+		if err := hw.SetStatus(status); err != nil {
+			t.Fatalf("SetStatus(%v) failed: %v", status, err)
+		}
+		if got := hw.Status(); got != status {
+			t.Errorf("got status %v after SetStatus(%v)", got, status)
+		}
+		if value, _ := relay.get(); value {
+			t.Errorf("relay line was left high after SetStatus(%v)", status)
+		}
+	}
+}
+
+func TestGPIOChipSetStatusStuck(t *testing.T) {
+	chip := newFakeGPIOChip()
+	cfg := testGPIOChipConfig()
+	hw, err := newGPIOChipHardware(chip, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The monitor never changes.
+	err = hw.SetStatus(lock.Unlocked)
+	stuck, ok := err.(StuckError)
+	if !ok {
+		t.Fatalf("got error %v, want a StuckError", err)
+	}
+	if stuck.Waited < cfg.ToggleWait.Duration {
+		t.Errorf("gave up after %v, want at least %v", stuck.Waited, cfg.ToggleWait.Duration)
+	}
+	if got := hw.Status(); got != lock.Locked {
+		t.Errorf("got status %v, want %v", got, lock.Locked)
+	}
+	if value, _ := chip.outputs[17].get(); value {
+		t.Errorf("relay line was left high")
+	}
+}
+
+func TestGPIOChipInfoDuringSetStatus(t *testing.T) {
+	chip := newFakeGPIOChip()
+	cfg := testGPIOChipConfig()
+	cfg.GPIOChip = "/dev/gpiochip0"
+	cfg.ToggleWait = Duration{time.Minute}
+	hw, err := newGPIOChipHardware(chip, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, monitor := chip.outputs[17], chip.inputs[22]
+	energized := make(chan struct{})
+	relay.onSet = func(value bool) {
+		if value {
+			close(energized)
+		}
+	}
+	done := make(chan error)
+	go func() { done <- hw.SetStatus(lock.Unlocked) }()
+	<-energized
+	// SetStatus is waiting for the monitor, which does not prevent the
+	// hardware from being described.
+	info := make(chan Info)
+	go func() { info <- hw.Info() }()
+	select {
+	case got := <-info:
+		if got.Pins["relay"] != "/dev/gpiochip0:17" || got.Pins["monitor"] != "/dev/gpiochip0:22" {
+			t.Errorf("got pins %v", got.Pins)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Info blocked while SetStatus was in progress")
+	}
+	monitor.set(true)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/davecheney/gpio"
+)
+
+func init() {
+	RegisterBackend("servo", newServoHardware)
+	RegisterBackend("hbridge", newHBridgeHardware)
+}
+
+// sysfsPWM is a PWM channel exposed by the Linux kernel under
+// /sys/class/pwm.
+type sysfsPWM struct {
+	chip    string // e.g. /sys/class/pwm/pwmchip0
+	channel int
+	dir     string // e.g. /sys/class/pwm/pwmchip0/pwm0
+}
+
+func openSysfsPWM(chip string, channel int, period time.Duration) (*sysfsPWM, error) {
+	dir := filepath.Join(chip, fmt.Sprintf("pwm%d", channel))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := writeSysfs(filepath.Join(chip, "export"), int64(channel)); err != nil {
+			return nil, fmt.Errorf("could not export PWM channel %d of %v: %v", channel, chip, err)
+		}
+	}
+	p := &sysfsPWM{chip: chip, channel: channel, dir: dir}
+	if err := p.write("enable", 0); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if err := p.write("period", int64(period)); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Close disables and unexports the PWM channel.
+func (p *sysfsPWM) Close() error {
+	p.write("enable", 0)
+	return writeSysfs(filepath.Join(p.chip, "unexport"), int64(p.channel))
+}
+
+func (p *sysfsPWM) write(attr string, value int64) error {
+	return writeSysfs(filepath.Join(p.dir, attr), value)
+}
+
+func writeSysfs(path string, value int64) error {
+	return ioutil.WriteFile(path, []byte(strconv.FormatInt(value, 10)), 0)
+}
+
+// servoMotor is a motor implemented by a servo, which holds the position
+// corresponding to the width of the pulses it receives.
+type servoMotor struct {
+	pwm           *sysfsPWM
+	lockedPulse   time.Duration
+	unlockedPulse time.Duration
+}
+
+func (m *servoMotor) Drive(unlocked bool) error {
+	pulse := m.lockedPulse
+	if unlocked {
+		pulse = m.unlockedPulse
+	}
+	if err := m.pwm.write("duty_cycle", int64(pulse)); err != nil {
+		return err
+	}
+	return m.pwm.write("enable", 1)
+}
+
+// Stop stops sending pulses, which releases the servo so that it does not
+// draw current (and jitter) while the bolt is at rest.
+func (m *servoMotor) Stop() error {
+	return m.pwm.write("enable", 0)
+}
+
+// hbridgeMotor is a motor implemented by a DC motor driven through an
+// H-bridge.
+type hbridgeMotor struct {
+	forward gpio.Pin
+	reverse gpio.Pin
+}
+
+func (m *hbridgeMotor) Drive(unlocked bool) error {
+	// Never drive both inputs high, which would short the H-bridge.
+	if unlocked {
+		m.reverse.Clear()
+		m.forward.Set()
+		return nil
+	}
+	m.forward.Clear()
+	m.reverse.Set()
+	return nil
+}
+
+func (m *hbridgeMotor) Stop() error {
+	m.forward.Clear()
+	m.reverse.Clear()
+	return nil
+}
+
+// positionSensor is the GPIO pin that senses the position of the bolt, if
+// any.
+type positionSensor struct {
+	pin gpio.Pin // nil if there is no PositionPin
+}
+
+func openPositionSensor(cfg MotorConfig, pins map[string]string) (positionSensor, error) {
+	if len(cfg.PositionPin) == 0 {
+		return positionSensor{}, nil
+	}
+	pin, err := gpio.OpenPin(gpioPin(cfg.PositionPin), gpio.ModeInput)
+	if err != nil {
+		return positionSensor{}, fmt.Errorf("could not open position pin %v: %v", cfg.PositionPin, err)
+	}
+	pins["position"] = cfg.PositionPin
+	return positionSensor{pin}, nil
+}
+
+// unlocked returns the function that reads the position of the bolt, or nil
+// if there is no position sensor.
+func (s positionSensor) unlocked() func() bool {
+	if s.pin == nil {
+		return nil
+	}
+	return s.pin.Get
+}
+
+func (s positionSensor) Close() error {
+	if s.pin == nil {
+		return nil
+	}
+	return s.pin.Close()
+}
+
+func newServoHardware(cfg HardwareConfig) (Hardware, error) {
+	m := cfg.Motor
+	pwm, err := openSysfsPWM(m.PWMChip, m.PWMChannel, m.PWMPeriod.Duration)
+	if err != nil {
+		return nil, err
+	}
+	info := Info{
+		Backend: "servo",
+		Pins:    map[string]string{"pwm": fmt.Sprintf("%v:%d", m.PWMChip, m.PWMChannel)},
+	}
+	position, err := openPositionSensor(m, info.Pins)
+	if err != nil {
+		pwm.Close()
+		return nil, err
+	}
+	hw, err := newMotorHardware(&servoMotor{pwm: pwm, lockedPulse: m.LockedPulse.Duration, unlockedPulse: m.UnlockedPulse.Duration}, position.unlocked(), info, cfg)
+	if err != nil {
+		pwm.Close()
+		position.Close()
+		return nil, err
+	}
+	return hw, nil
+}
+
+func newHBridgeHardware(cfg HardwareConfig) (Hardware, error) {
+	m := cfg.Motor
+	forward, err := gpio.OpenPin(gpioPin(m.ForwardPin), gpio.ModeOutput)
+	if err != nil {
+		return nil, fmt.Errorf("could not open forward pin %v: %v", m.ForwardPin, err)
+	}
+	forward.Clear()
+	reverse, err := gpio.OpenPin(gpioPin(m.ReversePin), gpio.ModeOutput)
+	if err != nil {
+		forward.Close()
+		return nil, fmt.Errorf("could not open reverse pin %v: %v", m.ReversePin, err)
+	}
+	reverse.Clear()
+	info := Info{
+		Backend: "hbridge",
+		Pins: map[string]string{
+			"forward": m.ForwardPin,
+			"reverse": m.ReversePin,
+		},
+	}
+	position, err := openPositionSensor(m, info.Pins)
+	if err != nil {
+		forward.Close()
+		reverse.Close()
+		return nil, err
+	}
+	hw, err := newMotorHardware(&hbridgeMotor{forward: forward, reverse: reverse}, position.unlocked(), info, cfg)
+	if err != nil {
+		forward.Close()
+		reverse.Close()
+		position.Close()
+		return nil, err
+	}
+	return hw, nil
+}
@@ -2,66 +2,66 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build arm
+// +build linux
 
 package internal
 
 import (
 	"fmt"
-	"sync"
-	"time"
 
 	"github.com/davecheney/gpio"
-	"github.com/davecheney/gpio/rpi"
-
-	"v.io/x/lock"
 )
 
-const toggleWaitTime = 5 * time.Second
+func init() {
+	RegisterBackend("rpi", newRPiHardware)
+}
 
-type hw struct {
+// rpiPins are the relayPins described in the README, accessed using the
+// sysfs GPIO interface.
+type rpiPins struct {
 	relay   gpio.Pin
 	monitor gpio.Pin
-	mu      sync.Mutex // To allow for only one SetStatus invocation at a time.
 }
 
-func init() {
-	relay, err := gpio.OpenPin(rpi.GPIO17, gpio.ModeOutput)
+func (p *rpiPins) SetRelay(on bool) {
+	if on {
+		p.relay.Set()
+		return
+	}
+	p.relay.Clear()
+}
+
+func (p *rpiPins) Monitor() bool {
+	return p.monitor.Get()
+}
+
+func newRPiHardware(cfg HardwareConfig) (Hardware, error) {
+	relay, err := gpio.OpenPin(gpioPin(cfg.RelayPin), gpio.ModeOutput)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("could not open relay pin %v: %v", cfg.RelayPin, err)
 	}
 	relay.Clear()
 
-	monitor, err := gpio.OpenPin(rpi.GPIO22, gpio.ModeInput)
+	monitor, err := gpio.OpenPin(gpioPin(cfg.MonitorPin), gpio.ModeInput)
 	if err != nil {
 		relay.Close()
-		panic(err)
+		return nil, fmt.Errorf("could not open monitor pin %v: %v", cfg.MonitorPin, err)
 	}
 
-	hardware = &hw{relay: relay, monitor: monitor}
-}
-
-func (hw *hw) Status() lock.LockStatus {
-	if hw.monitor.Get() {
-		return lock.Unlocked
-	}
-	return lock.Locked
-}
-
-func (hw *hw) SetStatus(status lock.LockStatus) error {
-	hw.mu.Lock()
-	defer hw.mu.Unlock()
-	desired := (status == lock.Unlocked)
-	// TODO(ashankar): Change this to work with an actual relay. Currently
-	// simulating the "motor" with an active buzzer.
-	defer hw.relay.Clear()
-	hw.relay.Set()
-	start := time.Now()
-	for hw.monitor.Get() != desired {
-		if d := time.Since(start); d > toggleWaitTime {
-			return fmt.Errorf("lock state unchanged after %v: might be stuck. aborting.", d)
+	var pins relayPins = &rpiPins{relay: relay, monitor: monitor}
+	if len(cfg.RecordFile) > 0 {
+		if pins, err = newRecordingPins(pins, cfg.RecordFile); err != nil {
+			relay.Close()
+			monitor.Close()
+			return nil, fmt.Errorf("could not record to %v: %v", cfg.RecordFile, err)
 		}
-		time.Sleep(200 * time.Millisecond)
 	}
-	return nil
+	info := Info{
+		Backend: "rpi",
+		Pins: map[string]string{
+			"relay":   cfg.RelayPin,
+			"monitor": cfg.MonitorPin,
+		},
+	}
+	return newRelayHardware(pins, info, cfg), nil
 }
@@ -2,59 +2,127 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build !arm
-
 package internal
 
 import (
 	"fmt"
 	"math/rand"
 	"os"
-	"os/signal"
 	"sync"
+	"time"
 
+	"v.io/x/lib/vlog"
 	"v.io/x/lock"
 )
 
-type hw struct {
-	mu     sync.Mutex
-	status lock.LockStatus // GUARDED_BY(mu)
+func init() {
+	RegisterBackend("simulated", newSimulatedHardware)
 }
 
-func init() {
-	hw := &hw{status: lock.Unlocked}
-	sigch := make(chan os.Signal)
-	signal.Notify(sigch, os.Interrupt)
-	go func() {
-		for range sigch {
-			fmt.Fprintln(os.Stderr, "simulated: externally initiated status change")
-			if hw.Status() == lock.Locked {
-				hw.setStatus(lock.Unlocked)
-				continue
-			}
-			hw.setStatus(lock.Locked)
-		}
-	}()
-	hardware = hw
-	fmt.Fprintln(os.Stderr, "Using simulated hardware. Simulate external locking/unlocking with: kill -SIGINT", os.Getpid())
-}
-
-func (hw *hw) Status() lock.LockStatus {
+// simulatedHardware is a Hardware that keeps the state of the lock in memory.
+//
+// Its behaviour is deterministic: state changes succeed immediately unless
+// instructed otherwise through the control socket (see serveSimulatedControl) or
+// unless HardwareConfig.SimulatedFailureRate is set.
+//
+// The settings made through the control socket are kept apart from cfg, so
+// that they survive reloads of the configuration.
+type simulatedHardware struct {
+	actuating sync.Mutex // To allow for only one SetStatus invocation at a time.
+
+	mu       sync.Mutex
+	status   lock.LockStatus // GUARDED_BY(mu)
+	cfg      HardwareConfig  // GUARDED_BY(mu)
+	latency  time.Duration   // GUARDED_BY(mu)
+	jammed   bool            // GUARDED_BY(mu)
+	failNext string          // GUARDED_BY(mu), the error to fail the next SetStatus with, if not empty
+	battery  float64         // GUARDED_BY(mu)
+	// failureRate, if not negative, is the failure rate set through the
+	// control socket, which overrides cfg.SimulatedFailureRate.
+	failureRate float64 // GUARDED_BY(mu)
+}
+
+func newSimulatedHardware(cfg HardwareConfig) (Hardware, error) {
+	hw := &simulatedHardware{status: lock.Unlocked, cfg: cfg, battery: 1, failureRate: -1}
+	if len(cfg.SimulatedControlSocket) == 0 {
+		fmt.Fprintln(os.Stderr, "Using simulated hardware. Set Hardware.SimulatedControlSocket to control it.")
+		return hw, nil
+	}
+	if err := listenSimulatedControl(cfg.SimulatedControlSocket, hw); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "Using simulated hardware. Control it with: nc -U", cfg.SimulatedControlSocket)
+	return hw, nil
+}
+
+func (hw *simulatedHardware) Reconfigure(cfg HardwareConfig) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if cfg.SimulatedControlSocket != hw.cfg.SimulatedControlSocket {
+		return fmt.Errorf("cannot change the control socket from %q to %q without restarting", hw.cfg.SimulatedControlSocket, cfg.SimulatedControlSocket)
+	}
+	hw.cfg = cfg
+	return nil
+}
+
+func (hw *simulatedHardware) Status() lock.LockStatus {
 	hw.mu.Lock()
 	defer hw.mu.Unlock()
 	return hw.status
 }
 
-func (hw *hw) SetStatus(status lock.LockStatus) error {
-	// Randomly fail with 10% chance, just for fun.
-	if rand.Intn(10) == 1 {
+func (hw *simulatedHardware) Info() Info {
+	return Info{Backend: "simulated"}
+}
+
+func (hw *simulatedHardware) SetStatus(status lock.LockStatus) error {
+	hw.actuating.Lock()
+	defer hw.actuating.Unlock()
+
+	hw.mu.Lock()
+	failNext, latency, jammed, failureRate, cfg := hw.failNext, hw.latency, hw.jammed, hw.failureRateLocked(), hw.cfg
+	hw.failNext = ""
+	hw.mu.Unlock()
+
+	if len(failNext) > 0 {
+		return fmt.Errorf("simulated error: %v", failNext)
+	}
+	if failureRate > 0 && rand.Float64() < failureRate {
 		return fmt.Errorf("simulated error: lock failed to toggle - check the door")
 	}
+	// Like the real hardware, give up if the bolt has not moved after
+	// ToggleWait.
+	if wait := cfg.ToggleWait.Duration; jammed || latency > wait {
+		time.Sleep(wait)
+		return StuckError{Waited: wait}
+	}
+	time.Sleep(latency)
 	hw.setStatus(status)
 	return nil
 }
 
-func (hw *hw) setStatus(status lock.LockStatus) {
+// failureRateLocked returns the fraction of the state changes that fail at
+// random.
+//
+// REQUIRES: hw.mu is held.
+func (hw *simulatedHardware) failureRateLocked() float64 {
+	if hw.failureRate >= 0 {
+		return hw.failureRate
+	}
+	return hw.cfg.SimulatedFailureRate
+}
+
+func (hw *simulatedHardware) BatteryLevel() (float64, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	return hw.battery, nil
+}
+
+func (hw *simulatedHardware) Buzz(d time.Duration) {
+	vlog.Infof("simulated: buzzing for %v", d)
+}
+
+func (hw *simulatedHardware) setStatus(status lock.LockStatus) {
 	hw.mu.Lock()
 	hw.status = status
 	hw.mu.Unlock()
@@ -0,0 +1,44 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimulatedReconfigureKeepsControlSettings(t *testing.T) {
+	cfg := DefaultConfig().Hardware
+	cfg.SimulatedFailureRate = 0.1
+	h, err := newSimulatedHardware(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw := h.(*simulatedHardware)
+	status := func() string {
+		out, err := hw.control("status", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if got, want := status(), "failure-rate=0.1 "; !strings.Contains(got, want) {
+		t.Errorf("got status %q, want it to contain %q", got, want)
+	}
+	for _, cmd := range [][]string{{"failure-rate", "0.5"}, {"latency", "2s"}} {
+		if _, err := hw.control(cmd[0], cmd[1:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.SimulatedFailureRate = 0.2
+	if err := hw.Reconfigure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"failure-rate=0.5 ", "latency=2s "} {
+		if got := status(); !strings.Contains(got, want) {
+			t.Errorf("got status %q after reloading, want it to contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/davecheney/gpio"
+)
+
+func init() {
+	RegisterBackend("strike", newGPIOStrikeHardware)
+}
+
+func newGPIOStrikeHardware(cfg HardwareConfig) (Hardware, error) {
+	strike, err := gpio.OpenPin(gpioPin(cfg.Strike.StrikePin), gpio.ModeOutput)
+	if err != nil {
+		return nil, fmt.Errorf("could not open strike pin %v: %v", cfg.Strike.StrikePin, err)
+	}
+	info := Info{
+		Backend: "strike",
+		Pins:    map[string]string{"strike": cfg.Strike.StrikePin},
+	}
+	var doorOpen func() bool
+	if len(cfg.Strike.DoorPin) > 0 {
+		door, err := gpio.OpenPin(gpioPin(cfg.Strike.DoorPin), gpio.ModeInput)
+		if err != nil {
+			strike.Close()
+			return nil, fmt.Errorf("could not open door pin %v: %v", cfg.Strike.DoorPin, err)
+		}
+		doorOpen = door.Get
+		info.Pins["door"] = cfg.Strike.DoorPin
+	}
+	setStrike := func(energised bool) {
+		if energised {
+			strike.Set()
+			return
+		}
+		strike.Clear()
+	}
+	return newStrikeHardware(setStrike, doorOpen, info, cfg), nil
+}
@@ -8,6 +8,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -16,8 +17,33 @@ import (
 	"v.io/x/lock/lockd/internal"
 )
 
+var (
+	configDir = flag.String("config-dir", "", "Directory containing the lockd configuration file to use. The default configuration is used if empty.")
+	backend   = flag.String("hardware", "", "Name of the hardware backend to test, one of: "+strings.Join(internal.Backends(), ", ")+". If empty, the backend in the configuration is used, or the default backend if none is configured.")
+)
+
 func main() {
-	hw := internal.GetHardware()
+	flag.Parse()
+	cfg := internal.DefaultConfig()
+	if len(*configDir) > 0 {
+		var err error
+		if cfg, err = internal.LoadConfig(*configDir); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+	}
+	name := *backend
+	if len(name) == 0 {
+		name = cfg.Hardware.Backend
+	}
+	if len(name) == 0 {
+		name = internal.DefaultBackend()
+	}
+	hw, err := internal.NewHardware(name, cfg.Hardware)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
 	fmt.Println("Commands are 'status', 'lock', 'unlock' or 'quit'")
 	bio := bufio.NewReader(os.Stdin)
 
@@ -0,0 +1,80 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Keypad is a keypad on which PINs are entered to unlock the lock.
+type Keypad interface {
+	// ReadPIN blocks until a PIN has been entered, and returns it.
+	ReadPIN() (string, error)
+}
+
+// NewKeypad returns the keypad described by cfg, or nil if cfg describes no
+// keypad.
+func NewKeypad(cfg KeypadConfig) (Keypad, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Type {
+	case "stdin":
+		fmt.Fprintln(os.Stderr, "Reading PINs from the standard input, one per line.")
+		return &stdinKeypad{bufio.NewScanner(os.Stdin)}, nil
+	case "matrix":
+		return openMatrixKeypad(cfg)
+	}
+	return nil, nil
+}
+
+// stdinKeypad is a Keypad that reads PINs, one per line, from the standard
+// input.
+type stdinKeypad struct {
+	scanner *bufio.Scanner
+}
+
+func (k *stdinKeypad) ReadPIN() (string, error) {
+	for k.scanner.Scan() {
+		if pin := strings.TrimSpace(k.scanner.Text()); len(pin) > 0 {
+			return pin, nil
+		}
+	}
+	if err := k.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("end of the standard input")
+}
+
+// pinEntry accumulates the keys pressed on a keypad into PINs.
+type pinEntry struct {
+	timeout time.Duration
+	keys    []byte
+	last    time.Time // When the last key was pressed.
+}
+
+// press records that key was pressed at time now, and returns the PIN entered
+// if key completes it.
+func (e *pinEntry) press(key byte, now time.Time) (pin string, done bool) {
+	if now.Sub(e.last) > e.timeout {
+		e.keys = e.keys[:0]
+	}
+	e.last = now
+	switch {
+	case key >= '0' && key <= '9':
+		e.keys = append(e.keys, key)
+	case key == '*':
+		e.keys = e.keys[:0]
+	case key == '#':
+		pin = string(e.keys)
+		e.keys = e.keys[:0]
+		return pin, len(pin) > 0
+	}
+	return "", false
+}
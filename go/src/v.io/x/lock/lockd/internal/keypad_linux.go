@@ -0,0 +1,90 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davecheney/gpio"
+)
+
+// matrixScanInterval is the interval at which a matrix keypad is scanned,
+// which is also long enough for the contacts of its keys to stop bouncing.
+const matrixScanInterval = 20 * time.Millisecond
+
+// matrixKeypad is a Keypad whose keys connect a row pin to a column pin when
+// pressed. It is scanned by driving one row high at a time and reading which
+// columns, pulled down externally, are high.
+type matrixKeypad struct {
+	rows    []gpio.Pin
+	columns []gpio.Pin
+	keys    []string
+	entry   pinEntry
+	pressed byte // The key pressed during the last scan, or 0 if none.
+}
+
+func openMatrixKeypad(cfg KeypadConfig) (Keypad, error) {
+	k := &matrixKeypad{keys: cfg.Keys, entry: pinEntry{timeout: cfg.EntryTimeout.Duration}}
+	for _, name := range cfg.RowPins {
+		pin, err := gpio.OpenPin(gpioPin(name), gpio.ModeOutput)
+		if err != nil {
+			k.close()
+			return nil, fmt.Errorf("could not open keypad row pin %v: %v", name, err)
+		}
+		pin.Clear()
+		k.rows = append(k.rows, pin)
+	}
+	for _, name := range cfg.ColumnPins {
+		pin, err := gpio.OpenPin(gpioPin(name), gpio.ModeInput)
+		if err != nil {
+			k.close()
+			return nil, fmt.Errorf("could not open keypad column pin %v: %v", name, err)
+		}
+		k.columns = append(k.columns, pin)
+	}
+	return k, nil
+}
+
+func (k *matrixKeypad) close() {
+	for _, pin := range append(k.rows, k.columns...) {
+		pin.Close()
+	}
+}
+
+// scan returns the key currently pressed, or 0 if none is.
+func (k *matrixKeypad) scan() byte {
+	for r, row := range k.rows {
+		row.Set()
+		for c, column := range k.columns {
+			if column.Get() {
+				row.Clear()
+				return k.keys[r][c]
+			}
+		}
+		row.Clear()
+	}
+	return 0
+}
+
+func (k *matrixKeypad) ReadPIN() (string, error) {
+	for {
+		time.Sleep(matrixScanInterval)
+		key := k.scan()
+		if key == k.pressed {
+			// Held down, or still released.
+			continue
+		}
+		k.pressed = key
+		if key == 0 {
+			continue
+		}
+		if pin, done := k.entry.press(key, time.Now()); done {
+			return pin, nil
+		}
+	}
+}
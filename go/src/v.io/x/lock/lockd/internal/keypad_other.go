@@ -0,0 +1,13 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package internal
+
+import "errors"
+
+func openMatrixKeypad(cfg KeypadConfig) (Keypad, error) {
+	return nil, errors.New("matrix keypads are only supported on Linux")
+}
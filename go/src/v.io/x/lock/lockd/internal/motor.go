@@ -0,0 +1,137 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+// motor abstracts a motor, such as a servo or a DC motor behind an H-bridge,
+// that moves the bolt of the lock.
+type motor interface {
+	// Drive starts moving the bolt towards the unlocked (unlocked=true) or
+	// the locked position.
+	Drive(unlocked bool) error
+	// Stop stops driving the motor.
+	Stop() error
+}
+
+// motorHardware is a Hardware that changes the state of the lock by driving a
+// motor for MotorConfig.TravelTime. If the bolt has a position sensor and it
+// shows that the bolt did not reach its target, the bolt is moved back and
+// driven again, up to MotorConfig.Retries times, in case it snagged.
+type motorHardware struct {
+	motor    motor
+	position func() bool // Returns true if the bolt is unlocked, nil if there is no position sensor.
+	info     Info
+
+	mu        sync.Mutex      // To allow for only one SetStatus invocation at a time.
+	cfg       HardwareConfig  // GUARDED_BY(mu)
+	commanded lock.LockStatus // GUARDED_BY(mu), the state the bolt was last moved to
+	known     bool            // GUARDED_BY(mu), whether the bolt has been moved since the hardware was created
+}
+
+// newMotorHardware returns a motorHardware that leaves the bolt where it is,
+// unless there is no position sensor and MotorConfig.HomeOnStart is set, in
+// which case it moves the bolt to the locked position. Until the bolt is
+// moved, a lock without a position sensor is reported as locked, unless
+// another state is assumed with AssumeStatus.
+func newMotorHardware(m motor, position func() bool, info Info, cfg HardwareConfig) (*motorHardware, error) {
+	hw := &motorHardware{motor: m, position: position, info: info, cfg: cfg, commanded: lock.Locked}
+	if position == nil && cfg.Motor.HomeOnStart {
+		if err := hw.move(lock.Locked); err != nil {
+			return nil, fmt.Errorf("could not move the bolt to the locked position: %v", err)
+		}
+		hw.known = true
+	}
+	return hw, nil
+}
+
+func (hw *motorHardware) Reconfigure(cfg HardwareConfig) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	// Only the timing of the motor can change while it is in use.
+	// HomeOnStart only matters when the hardware is created.
+	want := cfg.Motor
+	want.TravelTime, want.Retries = hw.cfg.Motor.TravelTime, hw.cfg.Motor.Retries
+	want.HomeOnStart = hw.cfg.Motor.HomeOnStart
+	if want != hw.cfg.Motor {
+		return fmt.Errorf("cannot change Hardware.Motor settings other than TravelTime, Retries and HomeOnStart without restarting")
+	}
+	hw.cfg = cfg
+	return nil
+}
+
+func (hw *motorHardware) Status() lock.LockStatus {
+	if hw.position != nil {
+		if hw.position() {
+			return lock.Unlocked
+		}
+		return lock.Locked
+	}
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	return hw.commanded
+}
+
+func (hw *motorHardware) AssumeStatus(status lock.LockStatus) bool {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.position != nil || hw.known {
+		return false
+	}
+	hw.commanded = status
+	return true
+}
+
+func (hw *motorHardware) Info() Info {
+	return hw.info
+}
+
+func (hw *motorHardware) SetStatus(status lock.LockStatus) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		if err := hw.move(status); err != nil {
+			return err
+		}
+		hw.commanded, hw.known = status, true
+		if hw.position == nil || hw.position() == (status == lock.Unlocked) {
+			return nil
+		}
+		if attempt == hw.cfg.Motor.Retries {
+			return StuckError{Waited: time.Since(start)}
+		}
+		vlog.Infof("Bolt did not reach the %v position, moving it back and retrying", status)
+		if err := hw.move(opposite(status)); err != nil {
+			return err
+		}
+	}
+}
+
+// move drives the motor towards the position for status for TravelTime.
+//
+// REQUIRES: hw.mu is held or hw is not in use yet.
+func (hw *motorHardware) move(status lock.LockStatus) error {
+	if err := hw.motor.Drive(status == lock.Unlocked); err != nil {
+		hw.motor.Stop()
+		return err
+	}
+	time.Sleep(hw.cfg.Motor.TravelTime.Duration)
+	return hw.motor.Stop()
+}
+
+func opposite(status lock.LockStatus) lock.LockStatus {
+	if status == lock.Locked {
+		return lock.Unlocked
+	}
+	return lock.Locked
+}
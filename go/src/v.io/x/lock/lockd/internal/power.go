@@ -0,0 +1,67 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// NewPowerSensor returns the sensor of the battery of hw described by cfg:
+// an ADC if cfg configures one, or else hw itself if it is a PowerSensor. It
+// returns nil if the battery cannot be sensed.
+func NewPowerSensor(hw Hardware, cfg PowerConfig) (PowerSensor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.ADC) > 0 {
+		s := &iioPowerSensor{cfg: cfg}
+		// Fail early if the ADC cannot be read.
+		if _, err := s.BatteryLevel(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if s, ok := hw.(PowerSensor); ok {
+		return s, nil
+	}
+	return nil, nil
+}
+
+// iioPowerSensor is a PowerSensor that measures the voltage of the battery
+// with an ADC supported by the Linux industrial I/O subsystem.
+type iioPowerSensor struct {
+	cfg PowerConfig
+}
+
+func (s *iioPowerSensor) BatteryLevel() (float64, error) {
+	raw, err := readFloat(s.cfg.ADC + "_raw")
+	if err != nil {
+		return 0, err
+	}
+	// The scale converts raw values to millivolts.
+	scale, err := readFloat(s.cfg.ADC + "_scale")
+	if err != nil {
+		return 0, err
+	}
+	volts := raw * scale / 1000 * s.cfg.Divider
+	level := (volts - s.cfg.EmptyVoltage) / (s.cfg.FullVoltage - s.cfg.EmptyVoltage)
+	switch {
+	case level < 0:
+		return 0, nil
+	case level > 1:
+		return 1, nil
+	}
+	return level, nil
+}
+
+func readFloat(path string) (float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"v.io/x/lock"
+)
+
+// relayPins abstracts the two pins of the circuitry described in the README:
+// a relay that makes the lock change state while it is energised, and a
+// monitor that senses the state of the lock.
+type relayPins interface {
+	// SetRelay energises (on=true) or releases (on=false) the relay.
+	SetRelay(on bool)
+	// Monitor returns true if the lock is unlocked.
+	Monitor() bool
+}
+
+// relayHardware is a Hardware that changes the state of the lock by
+// energising a relay until the monitor reflects the desired state, polling
+// the monitor meanwhile.
+type relayHardware struct {
+	pins relayPins
+	info Info
+	mu   sync.Mutex     // To allow for only one SetStatus invocation at a time.
+	cfg  HardwareConfig // GUARDED_BY(mu)
+}
+
+func newRelayHardware(pins relayPins, info Info, cfg HardwareConfig) *relayHardware {
+	return &relayHardware{pins: pins, info: info, cfg: cfg}
+}
+
+func (hw *relayHardware) Reconfigure(cfg HardwareConfig) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err := checkSamePins(hw.cfg, cfg); err != nil {
+		return err
+	}
+	if hw.cfg.ScenarioFile != cfg.ScenarioFile || hw.cfg.RecordFile != cfg.RecordFile {
+		return fmt.Errorf("cannot change Hardware.ScenarioFile or Hardware.RecordFile without restarting")
+	}
+	hw.cfg = cfg
+	return nil
+}
+
+func (hw *relayHardware) Status() lock.LockStatus {
+	if hw.pins.Monitor() {
+		return lock.Unlocked
+	}
+	return lock.Locked
+}
+
+func (hw *relayHardware) Info() Info {
+	return hw.info
+}
+
+func (hw *relayHardware) SetStatus(status lock.LockStatus) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	desired := (status == lock.Unlocked)
+	// TODO(ashankar): Change this to work with an actual relay. Currently
+	// simulating the "motor" with an active buzzer.
+	defer hw.pins.SetRelay(false)
+	hw.pins.SetRelay(true)
+	start := time.Now()
+	for hw.pins.Monitor() != desired {
+		if d := time.Since(start); d > hw.cfg.ToggleWait.Duration {
+			return StuckError{Waited: d}
+		}
+		time.Sleep(hw.cfg.PollInterval.Duration)
+	}
+	return nil
+}
+
+// Close closes the pins of the hardware, if they need to be, e.g. to flush a
+// recording (see HardwareConfig.RecordFile).
+func (hw *relayHardware) Close() error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if c, ok := hw.pins.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Buzz energises the relay for d, for circuitry in which the relay drives a
+// buzzer rather than the lock.
+func (hw *relayHardware) Buzz(d time.Duration) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	pins := hw.pins
+	if r, ok := pins.(*recordingPins); ok {
+		// Buzzing does not change the state of the lock, so it must not be
+		// recorded as an activation of the relay.
+		pins = r.relayPins
+	}
+	pins.SetRelay(true)
+	time.Sleep(d)
+	pins.SetRelay(false)
+}
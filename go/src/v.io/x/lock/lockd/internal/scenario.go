@@ -0,0 +1,329 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+)
+
+func init() {
+	RegisterBackend("scenario", newScenarioHardware)
+}
+
+// Scenario describes the behaviour of the monitor of the circuitry described
+// in the README over time. Scenarios are read from JSON files, e.g.:
+//
+//   {
+//     "Unlocked": true,
+//     "Actuations": [
+//       {"Transitions": [{"At": "800ms", "Unlocked": false}]},
+//       {"Transitions": [
+//         {"At": "700ms", "Unlocked": true},
+//         {"At": "720ms", "Unlocked": false},
+//         {"At": "750ms", "Unlocked": true}
+//       ]},
+//       {"Transitions": []}
+//     ],
+//     "Spontaneous": [{"At": "1m", "Unlocked": false}]
+//   }
+//
+// describes a lock that locks 800ms after the relay is first energised,
+// unlocks with a bouncy contact the second time, is stuck the third time and
+// is locked by hand a minute after the scenario starts.
+//
+// The "scenario" backend replays such files, as well as the recordings that
+// the "rpi" backend makes when Hardware.RecordFile is set.
+type Scenario struct {
+	// Unlocked is the initial value of the monitor.
+	Unlocked bool
+	// Actuations describes the response of the monitor to successive
+	// activations of the relay.
+	Actuations []ScenarioActuation
+	// Repeat makes Actuations start over once exhausted. Otherwise, the
+	// monitor does not respond to the relay anymore, as if the lock was
+	// stuck.
+	Repeat bool `json:",omitempty"`
+	// Spontaneous lists the transitions of the monitor that happen
+	// regardless of the relay (e.g. the lock being operated by hand), at
+	// times relative to the start of the scenario.
+	Spontaneous []ScenarioTransition `json:",omitempty"`
+}
+
+// ScenarioActuation describes the response of the monitor to one activation
+// of the relay.
+type ScenarioActuation struct {
+	// Transitions lists the transitions of the monitor, at times relative to
+	// the activation of the relay.
+	Transitions []ScenarioTransition
+}
+
+// ScenarioTransition is a change of the value of the monitor.
+type ScenarioTransition struct {
+	At       Duration
+	Unlocked bool
+}
+
+// LoadScenario reads and validates the scenario in the file at path, which
+// holds either a Scenario in JSON or a recording made with
+// Hardware.RecordFile.
+func LoadScenario(path string) (Scenario, error) {
+	var s Scenario
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if isRecording(data) {
+		s, err = parseRecording(data)
+	} else {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return s, fmt.Errorf("could not parse %v: %v", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, fmt.Errorf("invalid scenario in %v: %v", path, err)
+	}
+	return s, nil
+}
+
+// Validate returns an error describing the first problem found with s, or nil
+// if there is none.
+func (s Scenario) Validate() error {
+	check := func(what string, transitions []ScenarioTransition) error {
+		var last time.Duration
+		for i, t := range transitions {
+			if t.At.Duration < last {
+				return fmt.Errorf("%v: transition %d at %v happens before the previous one at %v", what, i, t.At, last)
+			}
+			last = t.At.Duration
+		}
+		return nil
+	}
+	for i, a := range s.Actuations {
+		if err := check(fmt.Sprintf("Actuations[%d]", i), a.Transitions); err != nil {
+			return err
+		}
+	}
+	return check("Spontaneous", s.Spontaneous)
+}
+
+// scenarioPins is a relayPins whose monitor behaves as described by a
+// Scenario.
+type scenarioPins struct {
+	now func() time.Time // time.Now, except in tests
+
+	mu       sync.Mutex
+	scenario Scenario
+	next     int                   // GUARDED_BY(mu), index of the actuation for the next activation of the relay
+	unlocked bool                  // GUARDED_BY(mu)
+	pending  []scheduledTransition // GUARDED_BY(mu), sorted by time
+}
+
+type scheduledTransition struct {
+	at       time.Time
+	unlocked bool
+}
+
+func newScenarioPins(s Scenario) *scenarioPins {
+	p := &scenarioPins{now: time.Now, scenario: s, unlocked: s.Unlocked}
+	p.schedule(p.now(), s.Spontaneous)
+	return p
+}
+
+// schedule adds transitions, at times relative to start, to p.pending.
+//
+// REQUIRES: p.mu is held or p is not in use yet.
+func (p *scenarioPins) schedule(start time.Time, transitions []ScenarioTransition) {
+	for _, t := range transitions {
+		p.pending = append(p.pending, scheduledTransition{at: start.Add(t.At.Duration), unlocked: t.Unlocked})
+	}
+	sort.SliceStable(p.pending, func(i, j int) bool { return p.pending[i].at.Before(p.pending[j].at) })
+}
+
+func (p *scenarioPins) SetRelay(on bool) {
+	if !on {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= len(p.scenario.Actuations) {
+		if !p.scenario.Repeat || len(p.scenario.Actuations) == 0 {
+			return
+		}
+		p.next = 0
+	}
+	p.schedule(p.now(), p.scenario.Actuations[p.next].Transitions)
+	p.next++
+}
+
+func (p *scenarioPins) Monitor() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for len(p.pending) > 0 && !p.pending[0].at.After(now) {
+		p.unlocked = p.pending[0].unlocked
+		p.pending = p.pending[1:]
+	}
+	return p.unlocked
+}
+
+func newScenarioHardware(cfg HardwareConfig) (Hardware, error) {
+	if len(cfg.ScenarioFile) == 0 {
+		return nil, fmt.Errorf("Hardware.ScenarioFile must be set to replay a scenario")
+	}
+	s, err := LoadScenario(cfg.ScenarioFile)
+	if err != nil {
+		return nil, err
+	}
+	return newRelayHardware(newScenarioPins(s), Info{Backend: "scenario"}, cfg), nil
+}
+
+// recordingPins is a relayPins that records the values of the relay and of
+// the monitor of the underlying relayPins to a file, from which LoadScenario
+// reads them as a Scenario. The file is only ever appended to, with a line for
+// every change, so that no change is lost if lockd stops.
+//
+// Only the values that are read are recorded, so the precision of the
+// recording is that of Hardware.PollInterval.
+type recordingPins struct {
+	relayPins
+	now   func() time.Time // time.Now, except in tests
+	start time.Time        // when recording started
+
+	mu    sync.Mutex
+	f     *os.File      // GUARDED_BY(mu), nil once closed
+	state recordedState // GUARDED_BY(mu), as last recorded
+}
+
+// recordedState is a line of a recording: the values of the relay and of the
+// monitor after a change of either, at a time relative to the start of the
+// recording. The first line records their initial values.
+type recordedState struct {
+	At       Duration
+	Relay    bool
+	Unlocked bool
+}
+
+func newRecordingPins(pins relayPins, path string) (*recordingPins, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	p := &recordingPins{relayPins: pins, now: time.Now, f: f}
+	p.start = p.now()
+	p.state.Unlocked = pins.Monitor()
+	p.recordLocked()
+	return p, nil
+}
+
+func (p *recordingPins) SetRelay(on bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.relayPins.SetRelay(on)
+	if on != p.state.Relay {
+		p.state.Relay = on
+		p.recordLocked()
+	}
+}
+
+func (p *recordingPins) Monitor() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unlocked := p.relayPins.Monitor()
+	if unlocked != p.state.Unlocked {
+		p.state.Unlocked = unlocked
+		p.recordLocked()
+	}
+	return unlocked
+}
+
+// Close flushes the recording to disk and closes its file. Changes are not
+// recorded anymore once it is closed.
+func (p *recordingPins) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Sync()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	p.f = nil
+	return err
+}
+
+// recordLocked appends p.state, as of now, to the recording.
+//
+// REQUIRES: p.mu is held or p is not in use yet.
+func (p *recordingPins) recordLocked() {
+	if p.f == nil {
+		return
+	}
+	p.state.At = Duration{p.now().Sub(p.start)}
+	data, err := json.Marshal(p.state)
+	if err == nil {
+		_, err = p.f.Write(append(data, '\n'))
+	}
+	if err != nil {
+		vlog.Errorf("Failed to record to %v: %v", p.f.Name(), err)
+	}
+}
+
+// isRecording returns true if data is a recording made by recordingPins
+// rather than a Scenario, i.e. if its first value has a Relay field, which
+// Scenario lacks.
+func isRecording(data []byte) bool {
+	var first struct{ Relay *bool }
+	return json.NewDecoder(bytes.NewReader(data)).Decode(&first) == nil && first.Relay != nil
+}
+
+// parseRecording converts a recording made by recordingPins to a Scenario.
+// The changes of the monitor while the relay is energised make up the
+// Actuations of the Scenario, and the others its Spontaneous transitions.
+func parseRecording(data []byte) (Scenario, error) {
+	var s Scenario
+	var last recordedState
+	var actuation time.Duration // when the relay was last energised
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var r recordedState
+		switch err := dec.Decode(&r); {
+		case err == io.EOF, err == io.ErrUnexpectedEOF && i > 0:
+			// The last line of a recording may be truncated if the
+			// device lost power while it was being written.
+			return s, nil
+		case err != nil:
+			return s, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if i == 0 {
+			s.Unlocked, last = r.Unlocked, r
+			continue
+		}
+		if r.Relay && !last.Relay {
+			actuation = r.At.Duration
+			s.Actuations = append(s.Actuations, ScenarioActuation{Transitions: []ScenarioTransition{}})
+		}
+		if r.Unlocked != last.Unlocked {
+			if r.Relay && len(s.Actuations) > 0 {
+				a := &s.Actuations[len(s.Actuations)-1]
+				a.Transitions = append(a.Transitions, ScenarioTransition{At: Duration{r.At.Duration - actuation}, Unlocked: r.Unlocked})
+			} else {
+				s.Spontaneous = append(s.Spontaneous, ScenarioTransition{At: r.At, Unlocked: r.Unlocked})
+			}
+		}
+		last = r
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"v.io/x/lock"
+)
+
+func transition(at time.Duration, unlocked bool) ScenarioTransition {
+	return ScenarioTransition{At: Duration{at}, Unlocked: unlocked}
+}
+
+func TestScenarioHardware(t *testing.T) {
+	cfg := DefaultConfig().Hardware
+	cfg.PollInterval = Duration{5 * time.Millisecond}
+	// ToggleWait is much longer than the transitions of the scenarios, so
+	// that slow machines do not make the tests fail.
+	cfg.ToggleWait = Duration{500 * time.Millisecond}
+
+	type step struct {
+		set   lock.LockStatus
+		stuck bool // whether SetStatus fails with a StuckError
+	}
+	tests := []struct {
+		name     string
+		scenario Scenario
+		steps    []step
+		// until is the time, in the scenario, at which its status is
+		// expected to be want. The clock of the scenario skips to it once
+		// the steps are done, rather than the test sleeping until then.
+		until time.Duration
+		want  lock.LockStatus
+	}{
+		{
+			name: "clean",
+			scenario: Scenario{
+				Unlocked:   true,
+				Actuations: []ScenarioActuation{{Transitions: []ScenarioTransition{transition(80*time.Millisecond, false)}}},
+			},
+			steps: []step{{set: lock.Locked}},
+			want:  lock.Locked,
+		},
+		{
+			name: "bouncy",
+			scenario: Scenario{
+				Actuations: []ScenarioActuation{{Transitions: []ScenarioTransition{
+					transition(70*time.Millisecond, true),
+					transition(72*time.Millisecond, false),
+					transition(75*time.Millisecond, true),
+				}}},
+			},
+			steps: []step{{set: lock.Unlocked}},
+			until: 100 * time.Millisecond,
+			want:  lock.Unlocked,
+		},
+		{
+			name: "stuck",
+			scenario: Scenario{
+				Unlocked:   true,
+				Actuations: []ScenarioActuation{{Transitions: []ScenarioTransition{}}},
+			},
+			steps: []step{{set: lock.Locked, stuck: true}},
+			want:  lock.Unlocked,
+		},
+		{
+			name: "exhausted",
+			scenario: Scenario{
+				Unlocked:   true,
+				Actuations: []ScenarioActuation{{Transitions: []ScenarioTransition{transition(10*time.Millisecond, false)}}},
+			},
+			steps: []step{{set: lock.Locked}, {set: lock.Unlocked, stuck: true}},
+			want:  lock.Locked,
+		},
+		{
+			name: "repeat",
+			scenario: Scenario{
+				Unlocked: true,
+				Actuations: []ScenarioActuation{
+					{Transitions: []ScenarioTransition{transition(10*time.Millisecond, false)}},
+					{Transitions: []ScenarioTransition{transition(10*time.Millisecond, true)}},
+				},
+				Repeat: true,
+			},
+			steps: []step{{set: lock.Locked}, {set: lock.Unlocked}, {set: lock.Locked}},
+			want:  lock.Locked,
+		},
+		{
+			name: "spontaneous",
+			scenario: Scenario{
+				Unlocked:    true,
+				Spontaneous: []ScenarioTransition{transition(time.Minute, false)},
+			},
+			until: time.Minute,
+			want:  lock.Locked,
+		},
+		{
+			// The example in the documentation of Scenario, with the
+			// times of the actuations scaled down.
+			name: "example",
+			scenario: Scenario{
+				Unlocked: true,
+				Actuations: []ScenarioActuation{
+					{Transitions: []ScenarioTransition{transition(80*time.Millisecond, false)}},
+					{Transitions: []ScenarioTransition{
+						transition(70*time.Millisecond, true),
+						transition(72*time.Millisecond, false),
+						transition(75*time.Millisecond, true),
+					}},
+					{Transitions: []ScenarioTransition{}},
+				},
+				Spontaneous: []ScenarioTransition{transition(time.Minute, false)},
+			},
+			steps: []step{{set: lock.Locked}, {set: lock.Unlocked}, {set: lock.Locked, stuck: true}},
+			until: time.Minute,
+			want:  lock.Locked,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.scenario.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			pins := newScenarioPins(test.scenario)
+			start, skipped := time.Now(), time.Duration(0)
+			pins.now = func() time.Time { return time.Now().Add(skipped) }
+			hw := newRelayHardware(pins, Info{Backend: "scenario"}, cfg)
+			initial := lock.Locked
+			if test.scenario.Unlocked {
+				initial = lock.Unlocked
+			}
+			if got := hw.Status(); got != initial {
+				t.Errorf("got initial status %v, want %v", got, initial)
+			}
+			for i, s := range test.steps {
+				err := hw.SetStatus(s.set)
+				stuck, isStuck := err.(StuckError)
+				switch {
+				case s.stuck && !isStuck:
+					t.Fatalf("step %d: SetStatus(%v) returned %v, want a StuckError", i, s.set, err)
+				case s.stuck && stuck.Waited < cfg.ToggleWait.Duration:
+					t.Errorf("step %d: SetStatus(%v) gave up after %v, want at least %v", i, s.set, stuck.Waited, cfg.ToggleWait.Duration)
+				case !s.stuck && err != nil:
+					t.Fatalf("step %d: SetStatus(%v) failed: %v", i, s.set, err)
+				}
+			}
+			if d := test.until - time.Since(start); d > 0 {
+				skipped = d
+			}
+			if got := hw.Status(); got != test.want {
+				t.Errorf("got status %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// fakeRelayPins is a relayPins whose monitor is set by tests.
+type fakeRelayPins struct {
+	relay, unlocked bool
+}
+
+func (p *fakeRelayPins) SetRelay(on bool) { p.relay = on }
+func (p *fakeRelayPins) Monitor() bool    { return p.unlocked }
+
+func TestRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockd-scenario-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording")
+
+	// steps are the values of the relay and of the monitor from the time at
+	// which they are read, since the start of the recording.
+	steps := []struct {
+		at              time.Duration
+		relay, unlocked bool
+	}{
+		{time.Second, false, false},
+		{2 * time.Second, true, false},
+		{2300 * time.Millisecond, true, true},
+		{2310 * time.Millisecond, true, false},
+		{2320 * time.Millisecond, true, true},
+		{2420 * time.Millisecond, false, true},
+		{3420 * time.Millisecond, true, true},
+		{3920 * time.Millisecond, false, true},
+		// Changes after the last actuation are recorded too.
+		{63920 * time.Millisecond, false, false},
+	}
+	want := Scenario{
+		Unlocked: true,
+		Actuations: []ScenarioActuation{
+			{Transitions: []ScenarioTransition{
+				transition(300*time.Millisecond, true),
+				transition(310*time.Millisecond, false),
+				transition(320*time.Millisecond, true),
+			}},
+			{Transitions: []ScenarioTransition{}},
+		},
+		Spontaneous: []ScenarioTransition{transition(time.Second, false), transition(63920*time.Millisecond, false)},
+	}
+
+	fake := &fakeRelayPins{unlocked: true}
+	rec, err := newRecordingPins(fake, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1e9, 0)
+	now := start
+	rec.now, rec.start = func() time.Time { return now }, start
+	for _, s := range steps {
+		now = start.Add(s.at)
+		fake.unlocked = s.unlocked
+		if s.relay != fake.relay {
+			rec.SetRelay(s.relay)
+		}
+		rec.Monitor()
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got scenario %+v, want %+v", got, want)
+	}
+
+	// Replaying the recording reproduces the values of the monitor.
+	replay := newScenarioPins(got)
+	replay.now = func() time.Time { return now }
+	// The spontaneous transitions were scheduled on the wall clock.
+	replay.pending = nil
+	replay.schedule(start, got.Spontaneous)
+	relay := false
+	for _, s := range steps {
+		now = start.Add(s.at)
+		if s.relay != relay {
+			replay.SetRelay(s.relay)
+			relay = s.relay
+		}
+		if got := replay.Monitor(); got != s.unlocked {
+			t.Errorf("%v: replayed monitor %v, want %v", s.at, got, s.unlocked)
+		}
+	}
+
+	// A line truncated by a power loss ends the recording.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"At":"1m`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, err := LoadScenario(path); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got (%+v, %v) with a truncated line, want (%+v, nil)", got, err, want)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+// simulatedController is implemented by simulated hardware that can be
+// manipulated through a control socket.
+type simulatedController interface {
+	// control executes the command cmd with arguments args, and returns its
+	// output.
+	control(cmd string, args []string) (string, error)
+}
+
+// listenSimulatedControl serves the control commands of c on a unix domain
+// socket at path.
+func listenSimulatedControl(path string, c simulatedController) error {
+	// Remove any socket left behind by a previous run.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("could not listen on control socket %v: %v", path, err)
+	}
+	go serveSimulatedControl(ln, c)
+	return nil
+}
+
+// simulatedControlHelp lists the commands accepted on the control socket of
+// the "simulated" backend, on a single line like every answer. "status"
+// prints the state of the simulated lock. "lock", "unlock" and "toggle"
+// change the state, as if done by hand. "fail-next" fails the next lock or
+// unlock operation, with the provided message if any. "latency" makes lock
+// and unlock operations take the provided duration. "jam" jams the bolt, so
+// that lock and unlock operations get stuck and manual changes are refused,
+// and "unjam" frees it. "failure-rate" fails a random fraction, in [0, 1), of
+// the operations, regardless of Hardware.SimulatedFailureRate, even once the
+// configuration is reloaded. "battery" sets the level of the battery, in
+// [0, 1].
+const simulatedControlHelp = "commands: status | lock | unlock | toggle | fail-next [message] | latency <duration> | jam | unjam | failure-rate <rate> | battery <level> | help"
+
+// serveSimulatedControl accepts connections on ln and executes the commands
+// sent on them (see e.g. simulatedControlHelp), one per line, until ln is
+// closed.
+//
+// Every command, including "help", is answered with a single line, which is
+// either "ok", the output of the command or an error starting with "error:".
+// For example:
+//
+//   $ echo "jam" | nc -U <socket>
+//   ok
+func serveSimulatedControl(ln net.Listener, c simulatedController) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			vlog.Infof("Stopped serving simulated hardware control commands: %v", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) == 0 {
+					continue
+				}
+				out, err := c.control(fields[0], fields[1:])
+				if err != nil {
+					out = fmt.Sprintf("error: %v", err)
+				}
+				fmt.Fprintln(conn, out)
+			}
+		}()
+	}
+}
+
+// control executes a single control command.
+func (hw *simulatedHardware) control(cmd string, args []string) (string, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	nargs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("%v: wrong number of arguments", cmd)
+		}
+		return nil
+	}
+	switch cmd {
+	case "help":
+		return simulatedControlHelp, nil
+	case "status":
+		if err := nargs(0, 0); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v jammed=%v latency=%v fail-next=%v failure-rate=%v battery=%v", hw.status, hw.jammed, hw.latency, len(hw.failNext) > 0, hw.failureRateLocked(), hw.battery), nil
+	case "lock", "unlock", "toggle":
+		if err := nargs(0, 0); err != nil {
+			return "", err
+		}
+		if hw.jammed {
+			return "", fmt.Errorf("the bolt is jammed")
+		}
+		switch {
+		case cmd == "lock":
+			hw.status = lock.Locked
+		case cmd == "unlock":
+			hw.status = lock.Unlocked
+		case hw.status == lock.Locked:
+			hw.status = lock.Unlocked
+		default:
+			hw.status = lock.Locked
+		}
+		vlog.Infof("simulated: externally initiated status change to %v", hw.status)
+		return hw.status.String(), nil
+	case "fail-next":
+		hw.failNext = "lock failed to toggle - check the door"
+		if len(args) > 0 {
+			hw.failNext = strings.Join(args, " ")
+		}
+		return "ok", nil
+	case "latency":
+		if err := nargs(1, 1); err != nil {
+			return "", err
+		}
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d < 0 {
+			return "", fmt.Errorf("invalid latency %q", args[0])
+		}
+		hw.latency = d
+		return "ok", nil
+	case "jam", "unjam":
+		if err := nargs(0, 0); err != nil {
+			return "", err
+		}
+		hw.jammed = cmd == "jam"
+		return "ok", nil
+	case "failure-rate":
+		if err := nargs(1, 1); err != nil {
+			return "", err
+		}
+		rate, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || rate < 0 || rate >= 1 {
+			return "", fmt.Errorf("invalid failure rate %q, must be in [0, 1)", args[0])
+		}
+		hw.failureRate = rate
+		return "ok", nil
+	case "battery":
+		if err := nargs(1, 1); err != nil {
+			return "", err
+		}
+		level, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || level < 0 || level > 1 {
+			return "", fmt.Errorf("invalid battery level %q, must be in [0, 1]", args[0])
+		}
+		hw.battery = level
+		return "ok", nil
+	}
+	return "", fmt.Errorf("unknown command %q, try \"help\"", cmd)
+}
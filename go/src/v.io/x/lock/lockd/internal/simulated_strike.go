@@ -0,0 +1,75 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+)
+
+func init() {
+	RegisterBackend("simulated-strike", newSimulatedStrikeHardware)
+}
+
+// simulatedStrike is a simulated electric strike, with a door sensor, whose
+// door can be opened and closed through the control socket.
+type simulatedStrike struct {
+	mu        sync.Mutex
+	energised bool // GUARDED_BY(mu)
+	doorOpen  bool // GUARDED_BY(mu)
+}
+
+// simulatedStrikeHelp lists the commands accepted on the control socket of
+// the "simulated-strike" backend, on a single line like every answer (see
+// serveSimulatedControl). "status" prints the state of the simulated strike
+// and door. "open" opens the door, which is only possible while the strike is
+// energised, and "close" closes it.
+const simulatedStrikeHelp = "commands: status | open | close | help"
+
+func newSimulatedStrikeHardware(cfg HardwareConfig) (Hardware, error) {
+	s := &simulatedStrike{}
+	if len(cfg.SimulatedControlSocket) > 0 {
+		if err := listenSimulatedControl(cfg.SimulatedControlSocket, s); err != nil {
+			return nil, err
+		}
+	}
+	return newStrikeHardware(s.setEnergised, s.isDoorOpen, Info{Backend: "simulated-strike"}, cfg), nil
+}
+
+func (s *simulatedStrike) setEnergised(energised bool) {
+	s.mu.Lock()
+	s.energised = energised
+	s.mu.Unlock()
+}
+
+func (s *simulatedStrike) isDoorOpen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doorOpen
+}
+
+func (s *simulatedStrike) control(cmd string, args []string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(args) > 0 {
+		return "", fmt.Errorf("%v: wrong number of arguments", cmd)
+	}
+	switch cmd {
+	case "help":
+		return simulatedStrikeHelp, nil
+	case "status":
+		return fmt.Sprintf("energised=%v door-open=%v", s.energised, s.doorOpen), nil
+	case "open":
+		if !s.energised && !s.doorOpen {
+			return "", fmt.Errorf("the strike is not energised")
+		}
+		s.doorOpen = true
+		return "ok", nil
+	case "close":
+		s.doorOpen = false
+		return "ok", nil
+	}
+	return "", fmt.Errorf("unknown command %q, try \"help\"", cmd)
+}
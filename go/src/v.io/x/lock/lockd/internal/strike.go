@@ -0,0 +1,110 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+// strikeHardware is a Hardware for electric strikes and solenoids (see
+// StrikeConfig). The lock is unlocked exactly while the strike is energised.
+type strikeHardware struct {
+	setStrike func(energised bool)
+	doorOpen  func() bool // nil if there is no door sensor
+	info      Info
+
+	mu        sync.Mutex
+	cfg       HardwareConfig // GUARDED_BY(mu)
+	energised bool           // GUARDED_BY(mu)
+	pulse     uint64         // GUARDED_BY(mu), incremented every time the state of the strike is set
+}
+
+func newStrikeHardware(setStrike func(bool), doorOpen func() bool, info Info, cfg HardwareConfig) *strikeHardware {
+	setStrike(false)
+	info.Relocks = true
+	return &strikeHardware{setStrike: setStrike, doorOpen: doorOpen, info: info, cfg: cfg}
+}
+
+func (hw *strikeHardware) Reconfigure(cfg HardwareConfig) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if cfg.Strike.StrikePin != hw.cfg.Strike.StrikePin || cfg.Strike.DoorPin != hw.cfg.Strike.DoorPin || cfg.SimulatedControlSocket != hw.cfg.SimulatedControlSocket {
+		return fmt.Errorf("cannot change Hardware.Strike.StrikePin, Hardware.Strike.DoorPin or Hardware.SimulatedControlSocket without restarting")
+	}
+	hw.cfg = cfg
+	return nil
+}
+
+func (hw *strikeHardware) Status() lock.LockStatus {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.energised {
+		return lock.Unlocked
+	}
+	return lock.Locked
+}
+
+func (hw *strikeHardware) Info() Info {
+	return hw.info
+}
+
+// SetStatus energises the strike when unlocking, and returns without waiting
+// for it to be de-energised. Unlocking while the strike is energised starts a
+// new pulse.
+func (hw *strikeHardware) SetStatus(status lock.LockStatus) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.pulse++
+	if status == lock.Locked {
+		hw.setEnergisedLocked(false)
+		return nil
+	}
+	hw.setEnergisedLocked(true)
+	go hw.endPulse(hw.pulse, time.Now().Add(hw.cfg.Strike.Pulse.Duration))
+	return nil
+}
+
+// endPulse de-energises the strike when the door opens or at deadline,
+// unless the state of the strike is set again meanwhile.
+func (hw *strikeHardware) endPulse(pulse uint64, deadline time.Time) {
+	wasOpen := hw.doorOpen != nil && hw.doorOpen()
+	for {
+		hw.mu.Lock()
+		if hw.pulse != pulse {
+			hw.mu.Unlock()
+			return
+		}
+		// The door opening, rather than being open, ends the pulse: it may
+		// have been left ajar when the lock was unlocked.
+		open := hw.doorOpen != nil && hw.doorOpen()
+		if open && !wasOpen {
+			vlog.Infof("Door opened, de-energising the strike")
+			hw.setEnergisedLocked(false)
+			hw.mu.Unlock()
+			return
+		}
+		if !time.Now().Before(deadline) {
+			vlog.Infof("Door not opened within %v, de-energising the strike", hw.cfg.Strike.Pulse)
+			hw.setEnergisedLocked(false)
+			hw.mu.Unlock()
+			return
+		}
+		wasOpen = open
+		interval := hw.cfg.PollInterval.Duration
+		hw.mu.Unlock()
+		time.Sleep(interval)
+	}
+}
+
+// REQUIRES: hw.mu is held.
+func (hw *strikeHardware) setEnergisedLocked(energised bool) {
+	hw.setStrike(energised)
+	hw.energised = energised
+}
@@ -0,0 +1,23 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+// EnclosureSwitch senses whether the enclosure of the lock device is open.
+type EnclosureSwitch interface {
+	// Open returns true if the enclosure is open.
+	Open() bool
+}
+
+// NewEnclosureSwitch returns the switch described by cfg, or nil if cfg
+// describes none.
+func NewEnclosureSwitch(cfg TamperConfig) (EnclosureSwitch, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.EnclosurePin) == 0 {
+		return nil, nil
+	}
+	return openEnclosureSwitch(cfg.EnclosurePin)
+}
@@ -0,0 +1,31 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/davecheney/gpio"
+)
+
+// gpioEnclosureSwitch is an EnclosureSwitch connected to a GPIO pin that is
+// high while the enclosure is open.
+type gpioEnclosureSwitch struct {
+	pin gpio.Pin
+}
+
+func openEnclosureSwitch(name string) (EnclosureSwitch, error) {
+	pin, err := gpio.OpenPin(gpioPin(name), gpio.ModeInput)
+	if err != nil {
+		return nil, fmt.Errorf("could not open enclosure pin %v: %v", name, err)
+	}
+	return &gpioEnclosureSwitch{pin: pin}, nil
+}
+
+func (s *gpioEnclosureSwitch) Open() bool {
+	return s.pin.Get()
+}
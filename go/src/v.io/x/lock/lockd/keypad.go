@@ -0,0 +1,100 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+)
+
+const (
+	// keypadBackoff is the time after a wrong PIN during which the PINs
+	// entered on the keypad are refused without being checked. It doubles
+	// with every consecutive wrong PIN, up to maxKeypadBackoff.
+	keypadBackoff    = time.Second
+	maxKeypadBackoff = time.Minute
+)
+
+// keypadThrottle slows down the guessing of PINs on the keypad of a lock.
+// After a wrong PIN, the PINs entered within a backoff that grows with every
+// consecutive wrong PIN are refused without being checked, and an alarm is
+// raised every alarmAfter consecutive wrong PINs. Wrong PINs also count
+// towards locking out the keypad, as keypadKey, in lockouts.
+type keypadThrottle struct {
+	lockouts   *lockoutTracker
+	alarmAfter int
+	failures   int       // the number of consecutive wrong PINs
+	until      time.Time // the end of the backoff after the last wrong PIN
+}
+
+// check returns an error describing why a PIN entered now is refused without
+// being checked, if it is.
+func (k *keypadThrottle) check() error {
+	if until, ok := k.lockouts.lockedOut(keypadKey); ok {
+		return fmt.Errorf("keypad locked out until %v", until.Format(time.RFC3339))
+	}
+	if now := k.lockouts.now(); now.Before(k.until) {
+		return fmt.Errorf("PIN entered less than %v after %d wrong PIN(s)", k.backoff(), k.failures)
+	}
+	return nil
+}
+
+// fail records a wrong PIN, and returns true if an alarm must be raised as a
+// result.
+func (k *keypadThrottle) fail() bool {
+	k.failures++
+	k.until = k.lockouts.now().Add(k.backoff())
+	return k.alarmAfter > 0 && k.failures%k.alarmAfter == 0
+}
+
+// succeed records a valid PIN, which ends the backoff.
+func (k *keypadThrottle) succeed() {
+	k.failures, k.until = 0, time.Time{}
+}
+
+func (k *keypadThrottle) backoff() time.Duration {
+	backoff := keypadBackoff
+	for i := 1; i < k.failures && backoff < maxKeypadBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxKeypadBackoff {
+		backoff = maxKeypadBackoff
+	}
+	return backoff
+}
+
+// serveKeypad unlocks l whenever a valid PIN is entered on its keypad, until
+// reading from the keypad fails.
+func (l *lockInstance) serveKeypad() {
+	for {
+		pin, err := l.keypad.ReadPIN()
+		if err != nil {
+			vlog.Errorf("Stopped reading PINs from the keypad of lock %q: %v", l.id, err)
+			return
+		}
+		if err := l.keypadThrottle.check(); err != nil {
+			vlog.Infof("Refused PIN entered on the keypad of lock %q: %v", l.id, err)
+			l.audit.record(auditEvent{Event: auditPINUnlock, Error: err.Error()})
+			continue
+		}
+		label, ok := l.pins.match(pin, time.Now())
+		if !ok {
+			vlog.Infof("Invalid PIN entered on the keypad of lock %q", l.id)
+			l.audit.record(auditEvent{Event: auditPINUnlock, Error: "invalid PIN"})
+			l.recordFailure(keypadKey, nil)
+			if l.keypadThrottle.fail() {
+				l.raiseAlarm(lock.AlarmKindKeypad)
+			}
+			continue
+		}
+		l.keypadThrottle.succeed()
+		vlog.Infof("Unlock requested with PIN %q", label)
+		err = l.setStatus(lock.Unlocked, lock.LockEvent{Cause: lock.LockEventCauseKeypad, PIN: label})
+		l.audit.record(auditEvent{Event: auditPINUnlock, PIN: label, Error: errorString(err)})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"v.io/x/lock/lockd/internal"
+)
+
+func TestKeypadThrottle(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	lockouts := newLockoutTracker(internal.LockoutConfig{
+		MaxFailures: 5,
+		Window:      internal.Duration{Duration: 10 * time.Minute},
+		Duration:    internal.Duration{Duration: 15 * time.Minute},
+	})
+	lockouts.now = func() time.Time { return now }
+	k := &keypadThrottle{lockouts: lockouts, alarmAfter: 3}
+	// wrongPIN records a wrong PIN as serveKeypad does, and returns whether
+	// the keypad is locked out and an alarm is raised as a result.
+	wrongPIN := func() (lockedOut, alarm bool) {
+		if err := k.check(); err != nil {
+			t.Fatalf("%v: PIN refused: %v", now, err)
+		}
+		_, lockedOut = lockouts.fail(keypadKey, nil)
+		return lockedOut, k.fail()
+	}
+
+	for i, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		lockedOut, alarm := wrongPIN()
+		if lockedOut {
+			t.Fatalf("keypad locked out after %d wrong PINs", i+1)
+		}
+		if want := i+1 == 3; alarm != want {
+			t.Errorf("got alarm %v after %d wrong PINs, want %v", alarm, i+1, want)
+		}
+		now = now.Add(backoff - time.Millisecond)
+		if err := k.check(); err == nil {
+			t.Errorf("PIN accepted %v after %d wrong PINs, want a backoff of %v", backoff-time.Millisecond, i+1, backoff)
+		}
+		now = now.Add(time.Millisecond)
+	}
+
+	// The fifth wrong PIN within the window of the lockout locks out the
+	// keypad, and PINs are refused until the lockout ends.
+	if lockedOut, _ := wrongPIN(); !lockedOut {
+		t.Fatalf("keypad not locked out after 5 wrong PINs")
+	}
+	if lockouts := lockouts.list(); len(lockouts) != 1 || lockouts[0].Key != keypadKey {
+		t.Errorf("got lockouts %v, want one of %q", lockouts, keypadKey)
+	}
+	now = now.Add(15*time.Minute - time.Second)
+	if err := k.check(); err == nil {
+		t.Errorf("PIN accepted while the keypad is locked out")
+	}
+	now = now.Add(time.Second)
+	if err := k.check(); err != nil {
+		t.Errorf("PIN refused after the lockout ended: %v", err)
+	}
+
+	// Wrong PINs keep raising alarms, and the backoff keeps growing, until a
+	// valid PIN is entered.
+	if _, alarm := wrongPIN(); !alarm {
+		t.Errorf("no alarm after 6 wrong PINs")
+	}
+	if got, want := k.backoff(), 32*time.Second; got != want {
+		t.Errorf("got backoff %v after 6 wrong PINs, want %v", got, want)
+	}
+	for i := 0; i < 3; i++ {
+		now = now.Add(maxKeypadBackoff)
+		wrongPIN()
+	}
+	if got := k.backoff(); got != maxKeypadBackoff {
+		t.Errorf("got backoff %v after 9 wrong PINs, want %v", got, maxKeypadBackoff)
+	}
+	k.succeed()
+	if err := k.check(); err != nil {
+		t.Errorf("PIN refused after a valid PIN: %v", err)
+	}
+	if _, alarm := wrongPIN(); alarm {
+		t.Errorf("alarm raised after a valid PIN and a wrong PIN")
+	}
+}
+
+func TestKeypadAlwaysTracked(t *testing.T) {
+	lockouts := newLockoutTracker(internal.LockoutConfig{
+		MaxFailures: 1,
+		Window:      internal.Duration{Duration: time.Minute},
+		Duration:    internal.Duration{Duration: time.Minute},
+	})
+	for i := 0; i < maxTrackedCallers; i++ {
+		if err := lockouts.attempt(nil, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+		lockouts.fail(fmt.Sprint(i), nil)
+	}
+	if _, lockedOut := lockouts.fail(keypadKey, nil); !lockedOut {
+		t.Errorf("keypad not locked out while %d callers are tracked", maxTrackedCallers)
+	}
+}
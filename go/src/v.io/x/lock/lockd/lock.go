@@ -8,35 +8,98 @@ import (
 	"v.io/v23/context"
 	"v.io/v23/rpc"
 	"v.io/v23/security"
+	"v.io/v23/verror"
 
 	"v.io/x/lib/vlog"
 	"v.io/x/lock"
-
-	"v.io/x/lock/lockd/internal"
 )
 
 type lockImpl struct {
-	hw internal.Hardware
+	l    *lockInstance
+	name string
 }
 
-func (l *lockImpl) Lock(ctx *context.T, call rpc.ServerCall) error {
+func (l *lockImpl) Lock(ctx *context.T, call rpc.ServerCall) (err error) {
 	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
 	vlog.Infof("Lock called by %q", remoteBlessingNames)
-	return l.hw.SetStatus(lock.Locked)
+	defer func() {
+		recordRPC(l.l.id, "Lock", callerCategory(l.name, remoteBlessingNames), err)
+		l.l.audit.record(auditEvent{Event: auditLock, Blessings: remoteBlessingNames, Error: errorString(err)})
+	}()
+	l.l.twoPerson.cancel()
+	return rpcError(ctx, l.l.setStatus(lock.Locked, lock.LockEvent{Cause: lock.LockEventCauseRemote, Blessings: remoteBlessingNames}))
 }
 
-func (l *lockImpl) Unlock(ctx *context.T, call rpc.ServerCall) error {
+func (l *lockImpl) Unlock(ctx *context.T, call rpc.ServerCall) (err error) {
 	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
 	vlog.Infof("Unlock called by %q", remoteBlessingNames)
-	return l.hw.SetStatus(lock.Unlocked)
+	defer func() { recordRPC(l.l.id, "Unlock", callerCategory(l.name, remoteBlessingNames), err) }()
+	return l.l.remoteUnlock(ctx, l.name, remoteKey(call.Security()), remoteBlessingNames)
+}
+
+// remoteUnlock unlocks the lock named lockName on behalf of the caller with
+// the provided key and blessing names, once approved by the owner of the
+// lock if the category of the caller requires it, and subject to the
+// two-person rule.
+func (l *lockInstance) remoteUnlock(ctx *context.T, lockName, key string, blessings []string) error {
+	timeout, approval := l.approval.required(callerCategory(lockName, blessings))
+	if approval {
+		if err := l.requestApproval(ctx, lockName, blessings, timeout); err != nil {
+			l.audit.record(auditEvent{Event: auditUnlock, Blessings: blessings, Error: errorString(err)})
+			return err
+		}
+	}
+	requester, window, ok := l.twoPerson.unlock(key, blessings)
+	if !ok {
+		vlog.Infof("Unlock of lock %q requested by %q, pending confirmation for %v", l.id, blessings, window)
+		l.audit.record(auditEvent{Event: auditUnlockReq, Blessings: blessings, Approved: approval})
+		return NewErrUnlockPending(ctx, window.String())
+	}
+	names := append(append([]string(nil), blessings...), requester...)
+	err := l.setStatus(lock.Unlocked, lock.LockEvent{Cause: lock.LockEventCauseRemote, Blessings: names})
+	l.audit.record(auditEvent{Event: auditUnlock, Blessings: blessings, RequestedBy: requester, Approved: approval, Error: errorString(err)})
+	return rpcError(ctx, err)
 }
 
 func (l *lockImpl) Status(ctx *context.T, call rpc.ServerCall) (lock.LockStatus, error) {
 	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
 	vlog.Infof("Status called by %q", remoteBlessingNames)
-	return l.hw.Status(), nil
+	recordRPC(l.l.id, "Status", callerCategory(l.name, remoteBlessingNames), nil)
+	return l.l.hw.Status(), nil
+}
+
+func (l *lockImpl) Alarms(ctx *context.T, call rpc.ServerCall) ([]lock.Alarm, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("Alarms called by %q", remoteBlessingNames)
+	recordRPC(l.l.id, "Alarms", callerCategory(l.name, remoteBlessingNames), nil)
+	return l.l.alarms.list(), nil
+}
+
+func (l *lockImpl) BatteryLevel(ctx *context.T, call rpc.ServerCall) (float64, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("BatteryLevel called by %q", remoteBlessingNames)
+	recordRPC(l.l.id, "BatteryLevel", callerCategory(l.name, remoteBlessingNames), nil)
+	if l.l.power == nil {
+		return 0, verror.New(verror.ErrNoExist, ctx, "battery")
+	}
+	level, err := l.l.power.BatteryLevel()
+	if err != nil {
+		return 0, verror.Convert(verror.ErrInternal, ctx, err)
+	}
+	return level, nil
+}
+
+func (l *lockImpl) PendingUnlock(ctx *context.T, call rpc.ServerCall) (lock.PendingUnlock, error) {
+	remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call.Security())
+	vlog.Infof("PendingUnlock called by %q", remoteBlessingNames)
+	recordRPC(l.l.id, "PendingUnlock", callerCategory(l.name, remoteBlessingNames), nil)
+	pending, ok := l.l.twoPerson.get()
+	if !ok {
+		return lock.PendingUnlock{}, verror.New(verror.ErrNoExist, ctx, "pending unlock")
+	}
+	return pending, nil
 }
 
-func newLock() lock.LockServerStub {
-	return lock.LockServer(&lockImpl{hw: internal.GetHardware()})
+func newLock(l *lockInstance, name string) lock.LockServerStub {
+	return lock.LockServer(&lockImpl{l: l, name: name})
 }
@@ -0,0 +1,232 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+// maxTrackedCallers bounds the number of callers whose attempts are tracked,
+// since each caller can present a key of its own choosing. It is documented in
+// internal.LockoutConfig.
+const maxTrackedCallers = 1000
+
+// keypadKey is the key by which the wrong PINs entered on the keypad of a lock
+// are tracked, as if the keypad were a caller. Unlike callers, the keypad is
+// tracked regardless of maxTrackedCallers.
+const keypadKey = "keypad"
+
+// lockoutMethods are the methods whose failed attempts count towards locking
+// out their caller, and which locked out callers are refused.
+var lockoutMethods = map[string]bool{
+	"Claim":  true,
+	"Lock":   true,
+	"Unlock": true,
+}
+
+// caller tracks the attempts of a caller, identified by its public key.
+type caller struct {
+	lastAttempt time.Time
+	failures    []time.Time // within the window of the lockoutTracker
+	blessings   []string    // presented in the most recent failed attempt
+	until       time.Time   // end of the lockout, if any
+}
+
+// lockoutTracker keeps track of the attempts of each caller, to lock out the
+// callers that fail too often (see internal.LockoutConfig). Lockouts are not
+// persisted, and end when lockd restarts.
+type lockoutTracker struct {
+	now func() time.Time // time.Now, except in tests
+
+	mu      sync.Mutex
+	cfg     internal.LockoutConfig // GUARDED_BY(mu)
+	callers map[string]*caller     // GUARDED_BY(mu), keyed by public key
+}
+
+func newLockoutTracker(cfg internal.LockoutConfig) *lockoutTracker {
+	return &lockoutTracker{now: time.Now, cfg: cfg, callers: make(map[string]*caller)}
+}
+
+func (t *lockoutTracker) setConfig(cfg internal.LockoutConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+}
+
+// attempt returns an error if the caller with the provided key is locked out,
+// or attempted to claim, lock or unlock the lock too recently, and records
+// the attempt otherwise.
+func (t *lockoutTracker) attempt(ctx *context.T, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	c := t.trackLocked(key, now)
+	if c == nil {
+		return nil
+	}
+	if now.Before(c.until) {
+		return NewErrLockedOut(ctx, c.until.Format(time.RFC3339))
+	}
+	if interval := t.cfg.MinInterval.Duration; interval > 0 && now.Sub(c.lastAttempt) < interval {
+		return NewErrRateLimited(ctx, interval.String())
+	}
+	c.lastAttempt = now
+	return nil
+}
+
+// lockedOut returns true, along with the end of the lockout, if the caller
+// with the provided key is locked out.
+func (t *lockoutTracker) lockedOut(key string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c := t.callers[key]; c != nil && t.now().Before(c.until) {
+		return c.until, true
+	}
+	return time.Time{}, false
+}
+
+// fail records a failed attempt by the caller with the provided key and
+// blessing names. It returns true, along with the end of the lockout, if the
+// caller is locked out as a result.
+func (t *lockoutTracker) fail(key string, blessings []string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.MaxFailures == 0 {
+		return time.Time{}, false
+	}
+	now := t.now()
+	c := t.trackLocked(key, now)
+	if c == nil {
+		return time.Time{}, false
+	}
+	c.failures = append(failuresSince(c.failures, now.Add(-t.cfg.Window.Duration)), now)
+	c.blessings = blessings
+	if len(c.failures) < t.cfg.MaxFailures {
+		return time.Time{}, false
+	}
+	c.failures = nil
+	c.until = now.Add(t.cfg.Duration.Duration)
+	return c.until, true
+}
+
+// list returns the callers that are currently locked out, the lockouts that
+// end first first.
+func (t *lockoutTracker) list() []lock.Lockout {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var ret []lock.Lockout
+	for key, c := range t.callers {
+		if now.Before(c.until) {
+			ret = append(ret, lock.Lockout{Key: key, Blessings: c.blessings, Until: c.until})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Until.Before(ret[j].Until) })
+	return ret
+}
+
+// trackLocked returns the caller with the provided key, which it starts
+// tracking if needed. It returns nil if the caller is not tracked because
+// maxTrackedCallers are tracked already.
+//
+// REQUIRES: t.mu is held.
+func (t *lockoutTracker) trackLocked(key string, now time.Time) *caller {
+	if c := t.callers[key]; c != nil {
+		return c
+	}
+	t.pruneLocked(now)
+	if key != keypadKey && len(t.callers) >= maxTrackedCallers {
+		vlog.Errorf("Not tracking the attempts of %v: already tracking %d callers", key, len(t.callers))
+		return nil
+	}
+	c := &caller{}
+	t.callers[key] = c
+	return c
+}
+
+// pruneLocked forgets the callers that are neither locked out nor limited by
+// their recent attempts.
+//
+// REQUIRES: t.mu is held.
+func (t *lockoutTracker) pruneLocked(now time.Time) {
+	for key, c := range t.callers {
+		c.failures = failuresSince(c.failures, now.Add(-t.cfg.Window.Duration))
+		if len(c.failures) == 0 && !now.Before(c.until) && now.Sub(c.lastAttempt) >= t.cfg.MinInterval.Duration {
+			delete(t.callers, key)
+		}
+	}
+}
+
+// failuresSince returns the times in failures, which are in increasing order,
+// that are after since.
+func failuresSince(failures []time.Time, since time.Time) []time.Time {
+	for i, f := range failures {
+		if f.After(since) {
+			return failures[i:]
+		}
+	}
+	return nil
+}
+
+// recordFailure records a failed attempt to claim, lock or unlock the lock by
+// the caller with the provided key and blessing names, and audits the caller
+// being locked out as a result.
+func (l *lockInstance) recordFailure(key string, blessings []string) {
+	until, lockedOut := l.lockouts.fail(key, blessings)
+	if !lockedOut {
+		return
+	}
+	vlog.Infof("Locked out %q (key %v) of lock %q until %v", blessings, key, l.id, until)
+	l.audit.record(auditEvent{Event: auditLockout, Blessings: blessings, Key: key})
+}
+
+// lockoutAuthorizer is a security.Authorizer that refuses the calls to
+// lockoutMethods by callers that are locked out of the lock l, and records
+// the calls to them that the underlying authorizer rejects as failures.
+type lockoutAuthorizer struct {
+	security.Authorizer
+	l *lockInstance
+}
+
+func (a lockoutAuthorizer) Authorize(ctx *context.T, call security.Call) error {
+	if !lockoutMethods[call.Method()] {
+		return a.Authorizer.Authorize(ctx, call)
+	}
+	key := remoteKey(call)
+	if err := a.l.lockouts.attempt(ctx, key); err != nil {
+		return err
+	}
+	err := a.Authorizer.Authorize(ctx, call)
+	if err != nil {
+		a.l.recordFailure(key, presentedBlessingNames(ctx, call))
+	}
+	return err
+}
+
+// remoteKey returns the public key of the caller, by which it is tracked by
+// a lockoutTracker.
+func remoteKey(call security.Call) string {
+	return fmt.Sprint(call.RemoteBlessings().PublicKey())
+}
+
+// presentedBlessingNames returns the names of the blessings presented by the
+// caller, including those that were rejected.
+func presentedBlessingNames(ctx *context.T, call security.Call) []string {
+	names, rejected := security.RemoteBlessingNames(ctx, call)
+	for _, r := range rejected {
+		names = append(names, r.Blessing)
+	}
+	return names
+}
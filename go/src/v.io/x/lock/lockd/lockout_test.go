@@ -0,0 +1,271 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/verror"
+
+	"v.io/x/lock/lockd/internal"
+)
+
+func testLockoutConfig() internal.LockoutConfig {
+	return internal.LockoutConfig{
+		MaxFailures: 3,
+		Window:      internal.Duration{Duration: time.Minute},
+		Duration:    internal.Duration{Duration: 5 * time.Minute},
+	}
+}
+
+func TestLockoutTracker(t *testing.T) {
+	type step struct {
+		advance time.Duration // before the step
+		key     string
+		// fail makes the step record a failed attempt, rather than
+		// attempt one.
+		fail bool
+		// want is the ID of the error expected from an attempt, or
+		// whether the caller is expected to be locked out by a failure.
+		want      verror.ID
+		lockedOut bool
+	}
+	attempt := func(advance time.Duration, want verror.ID) step {
+		return step{advance: advance, key: "k1", want: want}
+	}
+	fail := func(advance time.Duration, lockedOut bool) step {
+		return step{advance: advance, key: "k1", fail: true, lockedOut: lockedOut}
+	}
+	withMinInterval := testLockoutConfig()
+	withMinInterval.MinInterval = internal.Duration{Duration: 10 * time.Second}
+	disabled := testLockoutConfig()
+	disabled.MaxFailures = 0
+	tests := []struct {
+		name  string
+		cfg   internal.LockoutConfig
+		steps []step
+	}{
+		{
+			name: "locked out after MaxFailures",
+			cfg:  testLockoutConfig(),
+			steps: []step{
+				attempt(0, ""), fail(0, false),
+				attempt(time.Second, ""), fail(0, false),
+				attempt(time.Second, ""), fail(0, true),
+				attempt(time.Second, ErrLockedOut.ID),
+			},
+		},
+		{
+			name: "lockout expires",
+			cfg:  testLockoutConfig(),
+			steps: []step{
+				fail(0, false), fail(0, false), fail(0, true),
+				attempt(5*time.Minute-time.Nanosecond, ErrLockedOut.ID),
+				attempt(time.Nanosecond, ""),
+				// Failures before the lockout do not count anymore.
+				fail(0, false), fail(0, false), fail(0, true),
+			},
+		},
+		{
+			name: "failures outside the window",
+			cfg:  testLockoutConfig(),
+			steps: []step{
+				fail(0, false), fail(0, false),
+				fail(time.Minute, false),
+				fail(time.Second, false),
+				fail(time.Second, true),
+			},
+		},
+		{
+			name: "callers tracked separately",
+			cfg:  testLockoutConfig(),
+			steps: []step{
+				fail(0, false), fail(0, false), fail(0, true),
+				{key: "k2"},
+				{key: "k2", fail: true},
+				attempt(0, ErrLockedOut.ID),
+			},
+		},
+		{
+			name: "lockouts disabled",
+			cfg:  disabled,
+			steps: []step{
+				fail(0, false), fail(0, false), fail(0, false), fail(0, false),
+				attempt(0, ""),
+			},
+		},
+		{
+			name: "minimum interval",
+			cfg:  withMinInterval,
+			steps: []step{
+				attempt(0, ""),
+				attempt(10*time.Second-time.Nanosecond, ErrRateLimited.ID),
+				// Refused attempts do not delay the next one.
+				attempt(time.Nanosecond, ""),
+				{key: "k2"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Unix(1e9, 0)
+			tracker := newLockoutTracker(test.cfg)
+			tracker.now = func() time.Time { return now }
+			ctx := context.NewBackground()
+			for i, s := range test.steps {
+				now = now.Add(s.advance)
+				if s.fail {
+					if _, lockedOut := tracker.fail(s.key, []string{"caller"}); lockedOut != s.lockedOut {
+						t.Fatalf("step %d: fail(%q) got locked out %v, want %v", i, s.key, lockedOut, s.lockedOut)
+					}
+					continue
+				}
+				if got := verror.ErrorID(tracker.attempt(ctx, s.key)); got != s.want {
+					t.Fatalf("step %d: attempt(%q) got error ID %q, want %q", i, s.key, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLockoutTrackerEviction(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	cfg := testLockoutConfig()
+	cfg.MaxFailures = 1
+	tracker := newLockoutTracker(cfg)
+	tracker.now = func() time.Time { return now }
+	ctx := context.NewBackground()
+	for i := 0; i < maxTrackedCallers; i++ {
+		key := fmt.Sprint(i)
+		if err := tracker.attempt(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, lockedOut := tracker.fail(key, nil); !lockedOut {
+			t.Fatalf("caller %v not locked out", key)
+		}
+	}
+	// Callers that are locked out are not forgotten, so new callers are not
+	// tracked until their lockouts end.
+	now = now.Add(5*time.Minute - time.Second)
+	if err := tracker.attempt(ctx, "new"); err != nil {
+		t.Errorf("attempt by an untracked caller failed: %v", err)
+	}
+	if _, lockedOut := tracker.fail("new", nil); lockedOut {
+		t.Errorf("untracked caller locked out")
+	}
+	if got := len(tracker.list()); got != maxTrackedCallers {
+		t.Errorf("got %d lockouts, want %d", got, maxTrackedCallers)
+	}
+	now = now.Add(time.Second)
+	if err := tracker.attempt(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, lockedOut := tracker.fail("new", nil); !lockedOut {
+		t.Errorf("caller not locked out once the other lockouts ended")
+	}
+	if got := len(tracker.callers); got != 1 {
+		t.Errorf("got %d tracked callers, want 1", got)
+	}
+}
+
+// fakeCall is a security.Call by a caller with no blessings.
+type fakeCall struct {
+	security.Call
+	method string
+}
+
+func (c fakeCall) Method() string                      { return c.method }
+func (c fakeCall) RemoteBlessings() security.Blessings { return security.Blessings{} }
+
+// fakeAuthorizer is a security.Authorizer that refuses all calls with err.
+type fakeAuthorizer struct {
+	err error
+}
+
+func (a fakeAuthorizer) Authorize(*context.T, security.Call) error {
+	return a.err
+}
+
+func newTestLockInstance(t *testing.T, cfg internal.LockoutConfig) (*lockInstance, func()) {
+	dir, err := ioutil.TempDir("", "lockd-lockout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := openAuditLog(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	l := &lockInstance{configDir: dir, audit: audit, lockouts: newLockoutTracker(cfg)}
+	return l, func() {
+		audit.f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLockoutAuthorizer(t *testing.T) {
+	if got, want := len(lockoutMethods), 3; got != want {
+		t.Errorf("got %d methods subject to lockouts, want %d", got, want)
+	}
+	ctx := context.NewBackground()
+	denied := errors.New("denied")
+	for _, method := range []string{"Claim", "Lock", "Unlock", "Status", "Alarms", "SetPermissions"} {
+		t.Run(method, func(t *testing.T) {
+			l, cleanup := newTestLockInstance(t, testLockoutConfig())
+			defer cleanup()
+			auth := lockoutAuthorizer{fakeAuthorizer{denied}, l}
+			call := fakeCall{method: method}
+			for i := 0; i < 3; i++ {
+				if err := auth.Authorize(ctx, call); err != denied {
+					t.Fatalf("attempt %d got error %v, want %v", i, err, denied)
+				}
+			}
+			// The calls to the methods subject to lockouts are now
+			// refused without being tried, even if they would be
+			// authorized.
+			auth.Authorizer = fakeAuthorizer{}
+			err := auth.Authorize(ctx, call)
+			if got, want := verror.ErrorID(err) == ErrLockedOut.ID, lockoutMethods[method]; got != want {
+				t.Errorf("got error %v, want locked out %v", err, want)
+			}
+		})
+	}
+}
+
+// TestLockoutClaimFailures checks that the failures that Claim records itself,
+// since the unclaimed lock authorizes every caller, lock out their caller.
+func TestLockoutClaimFailures(t *testing.T) {
+	l, cleanup := newTestLockInstance(t, testLockoutConfig())
+	defer cleanup()
+	ctx := context.NewBackground()
+	auth := lockoutAuthorizer{fakeAuthorizer{}, l}
+	call := fakeCall{method: "Claim"}
+	for i := 0; i < 3; i++ {
+		if err := auth.Authorize(ctx, call); err != nil {
+			t.Fatalf("attempt %d failed: %v", i, err)
+		}
+		// As done by unclaimedLock.Claim when it fails.
+		l.recordFailure(remoteKey(call), presentedBlessingNames(ctx, call))
+	}
+	if err := auth.Authorize(ctx, call); verror.ErrorID(err) != ErrLockedOut.ID {
+		t.Errorf("got error %v, want the caller to be locked out", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(l.configDir, auditLogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(data), `"Event":"lockout"`), 1; got != want {
+		t.Errorf("got %d lockouts in the audit log, want %d:\n%s", got, want, data)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+	vsecurity "v.io/x/ref/lib/security"
+)
+
+const credentialsDirName = "credentials"
+
+// lockInstance is one of the locks managed by lockd, each of which is claimed
+// and served independently of the others.
+type lockInstance struct {
+	// id is the name of the lock in lockd.conf, or empty if lockd manages
+	// a single lock.
+	id string
+	// configDir is the directory in which the state of the lock is stored.
+	configDir string
+	// backend is the name of the hardware backend that created rawHW.
+	backend string
+	rawHW   internal.Hardware
+	hw      *instrumentedHardware
+	// keypad is nil if the lock has no keypad.
+	keypad       internal.Keypad
+	keypadConfig internal.KeypadConfig
+	pins         *pinStore
+	audit        *auditLog
+	watchers     *watchers
+	alarms       *alarmStore
+	holders      *keyHolders
+	tamperConfig internal.TamperConfig
+	// enclosure is nil if the lock device has no enclosure switch.
+	enclosure internal.EnclosureSwitch
+	// enclosureOpen is the last state of enclosure, and is only accessed by
+	// monitorStatus.
+	enclosureOpen bool
+	// power is nil if the battery of the lock cannot be sensed.
+	power       internal.PowerSensor
+	powerConfig internal.PowerConfig
+	// startupPolicy is the policy with which the lock was reconciled when
+	// lockd started (see internal.HardwareConfig.StartupPolicy).
+	startupPolicy string
+	lockouts      *lockoutTracker
+	twoPerson     *unlockRequests
+	approval      *approvalPolicy
+	// keypadThrottle is only accessed by serveKeypad.
+	keypadThrottle *keypadThrottle
+
+	pollMu sync.Mutex
+	// pollInterval is the interval at which the state of the lock is polled
+	// for changes that lockd did not cause.
+	pollInterval time.Duration // GUARDED_BY(pollMu)
+
+	// actuating is held while lockd changes the state of the lock, so that
+	// the changes it causes are not attributed to anyone else.
+	actuating sync.Mutex
+	status    lock.LockStatus // GUARDED_BY(actuating), the last observed state of the lock
+	state     lockState       // GUARDED_BY(actuating), as last saved
+}
+
+// newLockInstances creates the locks configured in cfg, including their
+// hardware.
+func newLockInstances(configDir string, cfg internal.Config) ([]*lockInstance, error) {
+	if len(cfg.Locks) == 0 {
+		l, err := newLockInstance("", configDir, cfg.Hardware)
+		if err != nil {
+			return nil, err
+		}
+		return []*lockInstance{l}, nil
+	}
+	var locks []*lockInstance
+	for _, lc := range cfg.Locks {
+		dir := internal.LockDir(configDir, lc.Name)
+		if err := os.MkdirAll(dir, os.FileMode(0700)); err != nil {
+			return nil, fmt.Errorf("could not create configuration directory %v for lock %q: %v", dir, lc.Name, err)
+		}
+		l, err := newLockInstance(lc.Name, dir, lc.Hardware)
+		if err != nil {
+			return nil, fmt.Errorf("lock %q: %v", lc.Name, err)
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+func newLockInstance(id, configDir string, cfg internal.HardwareConfig) (*lockInstance, error) {
+	backend := hardwareBackend(cfg)
+	hw, err := internal.NewHardware(backend, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %q hardware: %v", backend, err)
+	}
+	keypad, err := internal.NewKeypad(cfg.Keypad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize keypad: %v", err)
+	}
+	pins, err := loadPINStore(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PINs: %v", err)
+	}
+	audit, err := openAuditLog(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	alarms, err := loadAlarmStore(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alarms: %v", err)
+	}
+	holders, err := loadKeyHolders(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key holders: %v", err)
+	}
+	power, err := internal.NewPowerSensor(hw, cfg.Power)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize power sensor: %v", err)
+	}
+	enclosure, err := internal.NewEnclosureSwitch(cfg.Tamper)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize enclosure switch: %v", err)
+	}
+	// An enclosure that is open when lockd starts is assumed to be open for
+	// maintenance, rather than raising an alarm every time lockd restarts.
+	enclosureOpen := enclosure != nil && enclosure.Open()
+	if enclosureOpen {
+		vlog.Infof("The enclosure of lock %q is open", id)
+	}
+	l := &lockInstance{
+		id:            id,
+		configDir:     configDir,
+		backend:       backend,
+		rawHW:         hw,
+		hw:            newInstrumentedHardware(id, hw),
+		keypad:        keypad,
+		keypadConfig:  cfg.Keypad,
+		pins:          pins,
+		audit:         audit,
+		watchers:      newWatchers(),
+		alarms:        alarms,
+		holders:       holders,
+		tamperConfig:  cfg.Tamper,
+		enclosure:     enclosure,
+		enclosureOpen: enclosureOpen,
+		power:         power,
+		powerConfig:   cfg.Power,
+		pollInterval:  cfg.PollInterval.Duration,
+		startupPolicy: cfg.StartupPolicy,
+		lockouts:      newLockoutTracker(cfg.Lockout),
+		twoPerson:     newUnlockRequests(cfg.TwoPerson),
+		approval:      newApprovalPolicy(cfg.Approval),
+		status:        hw.Status(),
+	}
+	l.keypadThrottle = &keypadThrottle{lockouts: l.lockouts, alarmAfter: cfg.Keypad.AlarmAfter}
+	l.reconcile(cfg.StartupPolicy)
+	return l, nil
+}
+
+// hardwareConfigs returns the hardware configuration of each lock in cfg,
+// keyed by lockInstance.id.
+func hardwareConfigs(cfg internal.Config) map[string]internal.HardwareConfig {
+	if len(cfg.Locks) == 0 {
+		return map[string]internal.HardwareConfig{"": cfg.Hardware}
+	}
+	ret := make(map[string]internal.HardwareConfig)
+	for _, l := range cfg.Locks {
+		ret[l.Name] = l.Hardware
+	}
+	return ret
+}
+
+// withPrincipal returns a context in which the lock's principal is used.
+//
+// A lockd that manages a single lock uses its own principal for it. Otherwise,
+// each lock has a principal of its own, stored in its configuration directory
+// and created the first time it is used, so that each lock can be claimed
+// independently.
+func (l *lockInstance) withPrincipal(ctx *context.T) (*context.T, error) {
+	if len(l.id) == 0 {
+		return ctx, nil
+	}
+	dir := filepath.Join(l.configDir, credentialsDirName)
+	principal, err := vsecurity.LoadPersistentPrincipal(dir, nil)
+	if os.IsNotExist(err) {
+		if principal, err = vsecurity.CreatePersistentPrincipal(dir, nil); err != nil {
+			return nil, err
+		}
+		err = vsecurity.InitDefaultBlessings(principal, "lockd-"+l.id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load the credentials of lock %q from %v: %v", l.id, dir, err)
+	}
+	return v23.WithPrincipal(ctx, principal)
+}
+
+// close releases the hardware of the lock, if it needs to be, e.g. to flush a
+// recording of it (see internal.HardwareConfig.RecordFile).
+func (l *lockInstance) close() {
+	if c, ok := l.rawHW.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			vlog.Errorf("Failed to close the hardware of lock %q: %v", l.id, err)
+		}
+	}
+}
@@ -8,19 +8,34 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"v.io/v23/context"
 
 	"v.io/x/lib/cmdline"
+	"v.io/x/lock/lockd/internal"
 	"v.io/x/ref/lib/signals"
 	"v.io/x/ref/lib/v23cmd"
 	_ "v.io/x/ref/runtime/factories/roaming"
 )
 
-var configDir string
+var (
+	configDir   string
+	metricsAddr string
+	hardware    string
+
+	// version is the version of lockd reported in the lock's diagnostics. It
+	// can be set at build time with: -ldflags "-X main.version=<version>"
+	version = "unknown"
+
+	startTime = time.Now()
+)
 
 func main() {
 	cmdRoot.Flags.StringVar(&configDir, "config-dir", "", "Directory where the lock configuration files are stored. It will be created if it does not exist.")
+	cmdRoot.Flags.StringVar(&hardware, "hardware", "", fmt.Sprintf("Name of the hardware backend used to manipulate the lock, one of: %v. If empty, the backend in the configuration file is used, or %q if none is configured.", strings.Join(internal.Backends(), ", "), internal.DefaultBackend()))
+	cmdRoot.Flags.StringVar(&metricsAddr, "metrics-addr", "", "Address (host:port) on which to serve Prometheus metrics at /metrics. Metrics are not served if empty.")
 	cmdline.HideGlobalFlagsExcept()
 	cmdline.Main(cmdRoot)
 }
@@ -32,6 +47,13 @@ var cmdRoot = &cmdline.Command{
 	Long: `
 Command lockd runs the lockd server, which implements the UnclaimedLock or the Lock interface depending
 on the files in the configuration directory.
+
+The hardware backend used to manipulate the lock is selected with --hardware. The hardware and behaviour
+of lockd are otherwise configured by the file lockd.conf in the configuration directory,
+if it exists. lockd re-reads this file on receiving SIGHUP.
+
+A single lockd can manage several locks, listed in lockd.conf, each of which is claimed and served
+independently of the others, with its own hardware.
 `,
 }
 
@@ -47,11 +69,51 @@ func runLockD(ctx *context.T, env *cmdline.Env, args []string) error {
 		return fmt.Errorf("--config-dir=%v is not a directory", configDir)
 	}
 
-	shutdown, err := startServer(ctx, configDir)
+	cfg, err := internal.LoadConfig(configDir)
+	if err != nil {
+		return err
+	}
+	locks, err := newLockInstances(configDir, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to start server: %v", err)
+		return err
+	}
+	defer func() {
+		for _, l := range locks {
+			l.close()
+		}
+	}()
+	setMetricsCategories(cfg.MetricsCategories)
+	metrics := &metricsServer{locks: locks}
+	if err := metrics.listen(metricsAddress(cfg)); err != nil {
+		return fmt.Errorf("failed to serve metrics: %v", err)
+	}
+	defer metrics.close()
+	defer reloadConfigOnSIGHUP(configDir, locks, metrics)()
+
+	var shutdowns []func()
+	defer func() {
+		for _, shutdown := range shutdowns {
+			shutdown()
+		}
+	}()
+	for _, l := range locks {
+		lctx, err := l.withPrincipal(ctx)
+		if err != nil {
+			return err
+		}
+		shutdown, err := startServer(lctx, l)
+		if err != nil {
+			return fmt.Errorf("failed to start server for lock %q: %v", l.id, err)
+		}
+		shutdowns = append(shutdowns, shutdown)
+		go l.monitorStatus()
+		if l.power != nil {
+			go l.monitorBattery()
+		}
+		if l.keypad != nil {
+			go l.serveKeypad()
+		}
 	}
 	<-signals.ShutdownOnSignals(ctx)
-	shutdown()
 	return nil
 }
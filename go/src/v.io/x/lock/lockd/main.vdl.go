@@ -21,6 +21,14 @@ var _ = __VDLInit() // Must be first; see __VDLInit comments for details.
 var (
 	ErrLockAlreadyClaimed = verror.Register("v.io/x/lock/lockd.LockAlreadyClaimed", verror.NoRetry, "{1:}{2:} lock has already been claimed")
 	ErrInvalidLockName    = verror.Register("v.io/x/lock/lockd.InvalidLockName", verror.NoRetry, "{1:}{2:} invalid lock name ({3}: cannot contain {4})")
+	ErrInvalidPIN         = verror.Register("v.io/x/lock/lockd.InvalidPIN", verror.NoRetry, "{1:}{2:} invalid PIN: {3}")
+	ErrLowBattery         = verror.Register("v.io/x/lock/lockd.LowBattery", verror.NoRetry, "{1:}{2:} battery level {3}% is below the {4}% required to operate the lock")
+	ErrLockedOut          = verror.Register("v.io/x/lock/lockd.LockedOut", verror.RetryBackoff, "{1:}{2:} too many failed attempts, try again after {3}")
+	ErrRateLimited        = verror.Register("v.io/x/lock/lockd.RateLimited", verror.RetryBackoff, "{1:}{2:} attempts must be at least {3} apart")
+	ErrUnlockPending      = verror.Register("v.io/x/lock/lockd.UnlockPending", verror.NoRetry, "{1:}{2:} unlock requested, another key holder must also unlock within {3}")
+	ErrUnlockNotApproved  = verror.Register("v.io/x/lock/lockd.UnlockNotApproved", verror.NoRetry, "{1:}{2:} the owner of the lock did not approve the unlock: {3}")
+	ErrOwnerNotAdmin      = verror.Register("v.io/x/lock/lockd.OwnerNotAdmin", verror.NoRetry, "{1:}{2:} the permissions must grant Admin to the owner of the lock, {3}")
+	ErrKeyTooDeep         = verror.Register("v.io/x/lock/lockd.KeyTooDeep", verror.NoRetry, "{1:}{2:} key {3} extends a key that permits at most {4} further blessings")
 )
 
 // NewErrLockAlreadyClaimed returns an error with the ErrLockAlreadyClaimed ID.
@@ -33,6 +41,46 @@ func NewErrInvalidLockName(ctx *context.T, name string, reason string) error {
 	return verror.New(ErrInvalidLockName, ctx, name, reason)
 }
 
+// NewErrInvalidPIN returns an error with the ErrInvalidPIN ID.
+func NewErrInvalidPIN(ctx *context.T, reason string) error {
+	return verror.New(ErrInvalidPIN, ctx, reason)
+}
+
+// NewErrLowBattery returns an error with the ErrLowBattery ID.
+func NewErrLowBattery(ctx *context.T, level int32, min int32) error {
+	return verror.New(ErrLowBattery, ctx, level, min)
+}
+
+// NewErrLockedOut returns an error with the ErrLockedOut ID.
+func NewErrLockedOut(ctx *context.T, until string) error {
+	return verror.New(ErrLockedOut, ctx, until)
+}
+
+// NewErrRateLimited returns an error with the ErrRateLimited ID.
+func NewErrRateLimited(ctx *context.T, interval string) error {
+	return verror.New(ErrRateLimited, ctx, interval)
+}
+
+// NewErrUnlockPending returns an error with the ErrUnlockPending ID.
+func NewErrUnlockPending(ctx *context.T, window string) error {
+	return verror.New(ErrUnlockPending, ctx, window)
+}
+
+// NewErrUnlockNotApproved returns an error with the ErrUnlockNotApproved ID.
+func NewErrUnlockNotApproved(ctx *context.T, reason string) error {
+	return verror.New(ErrUnlockNotApproved, ctx, reason)
+}
+
+// NewErrOwnerNotAdmin returns an error with the ErrOwnerNotAdmin ID.
+func NewErrOwnerNotAdmin(ctx *context.T, owner string) error {
+	return verror.New(ErrOwnerNotAdmin, ctx, owner)
+}
+
+// NewErrKeyTooDeep returns an error with the ErrKeyTooDeep ID.
+func NewErrKeyTooDeep(ctx *context.T, key string, max uint32) error {
+	return verror.New(ErrKeyTooDeep, ctx, key, max)
+}
+
 var __VDLInitCalled bool
 
 // __VDLInit performs vdl initialization.  It is safe to call multiple times.
@@ -57,6 +105,14 @@ func __VDLInit() struct{} {
 	// Set error format strings.
 	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrLockAlreadyClaimed.ID), "{1:}{2:} lock has already been claimed")
 	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrInvalidLockName.ID), "{1:}{2:} invalid lock name ({3}: cannot contain {4})")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrInvalidPIN.ID), "{1:}{2:} invalid PIN: {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrLowBattery.ID), "{1:}{2:} battery level {3}% is below the {4}% required to operate the lock")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrLockedOut.ID), "{1:}{2:} too many failed attempts, try again after {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrRateLimited.ID), "{1:}{2:} attempts must be at least {3} apart")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrUnlockPending.ID), "{1:}{2:} unlock requested, another key holder must also unlock within {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrUnlockNotApproved.ID), "{1:}{2:} the owner of the lock did not approve the unlock: {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrOwnerNotAdmin.ID), "{1:}{2:} the permissions must grant Admin to the owner of the lock, {3}")
+	i18n.Cat().SetWithBase(i18n.LangID("en"), i18n.MsgID(ErrKeyTooDeep.ID), "{1:}{2:} key {3} extends a key that permits at most {4} further blessings")
 
 	return struct{}{}
 }
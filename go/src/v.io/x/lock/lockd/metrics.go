@@ -0,0 +1,299 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+const (
+	outcomeOK     = "ok"
+	outcomeError  = "error"
+	outcomeDenied = "denied"
+
+	categoryOwner   = "owner"
+	categoryUnknown = "unknown"
+	categoryOther   = "other"
+)
+
+// metricsCategories is the set of the key categories that label RPC metrics
+// (see internal.Config.MetricsCategories).
+var metricsCategories struct {
+	sync.Mutex
+	set map[string]bool // GUARDED_BY(Mutex)
+}
+
+var (
+	rpcCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lockd",
+		Name:      "rpcs_total",
+		Help:      "Number of RPCs received by each lock, by method, outcome and caller category.",
+	}, []string{"lock", "method", "outcome", "category"})
+
+	actuationLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lockd",
+		Name:      "actuation_seconds",
+		Help:      "Time taken by the hardware to change the state of each lock.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"lock", "status"})
+
+	hardwareErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lockd",
+		Name:      "hardware_errors_total",
+		Help:      "Number of failed attempts to change the state of each lock, by kind of failure.",
+	}, []string{"lock", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(rpcCounter, actuationLatency, hardwareErrors)
+}
+
+// startMetricsServer serves the registered metrics, along with gauges of the
+// current state and battery level of each of the provided locks, over HTTP at
+// addr/metrics.
+//
+// Returns a callback to be invoked to stop serving on success, or an error
+// on failure.
+func startMetricsServer(addr string, locks []*lockInstance) (func(), error) {
+	var states []prometheus.Collector
+	unregister := func() {
+		for _, state := range states {
+			prometheus.Unregister(state)
+		}
+	}
+	for _, l := range locks {
+		hw := l.hw
+		state := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "lockd",
+			Name:        "lock_state",
+			Help:        "Current state of each lock (0 for locked, 1 for unlocked).",
+			ConstLabels: prometheus.Labels{"lock": l.id},
+		}, func() float64 { return float64(hw.Status()) })
+		if err := prometheus.Register(state); err != nil {
+			unregister()
+			return nil, err
+		}
+		states = append(states, state)
+		if l.power == nil {
+			continue
+		}
+		power := l.power
+		battery := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "lockd",
+			Name:        "battery_level",
+			Help:        "Remaining charge of the battery of each lock, as a fraction of its capacity.",
+			ConstLabels: prometheus.Labels{"lock": l.id},
+		}, func() float64 {
+			level, err := power.BatteryLevel()
+			if err != nil {
+				return math.NaN()
+			}
+			return level
+		})
+		if err := prometheus.Register(battery); err != nil {
+			unregister()
+			return nil, err
+		}
+		states = append(states, battery)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		unregister()
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go http.Serve(ln, mux)
+	vlog.Infof("Serving metrics at http://%v/metrics", ln.Addr())
+	return func() {
+		ln.Close()
+		unregister()
+	}, nil
+}
+
+// metricsServer serves metrics on an address that can be changed while lockd
+// is running.
+type metricsServer struct {
+	locks []*lockInstance
+
+	mu   sync.Mutex
+	addr string // GUARDED_BY(mu), empty if metrics are not being served
+	stop func() // GUARDED_BY(mu)
+}
+
+// listen makes the server serve metrics on addr instead of the address it is
+// currently serving on, or stop serving metrics if addr is empty.
+func (m *metricsServer) listen(addr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if addr == m.addr {
+		return nil
+	}
+	m.closeLocked()
+	if len(addr) == 0 {
+		return nil
+	}
+	stop, err := startMetricsServer(addr, m.locks)
+	if err != nil {
+		return err
+	}
+	m.addr, m.stop = addr, stop
+	return nil
+}
+
+func (m *metricsServer) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeLocked()
+}
+
+func (m *metricsServer) closeLocked() {
+	if m.stop != nil {
+		m.stop()
+	}
+	m.addr, m.stop = "", nil
+}
+
+// instrumentedHardware is a Hardware that records the latency and failures
+// of every state change, both as metrics and for the lock's diagnostics.
+type instrumentedHardware struct {
+	internal.Hardware
+	lockID string
+
+	mu          sync.Mutex
+	actuations  uint64    // GUARDED_BY(mu)
+	lastErr     error     // GUARDED_BY(mu)
+	lastErrTime time.Time // GUARDED_BY(mu)
+}
+
+func newInstrumentedHardware(lockID string, hw internal.Hardware) *instrumentedHardware {
+	return &instrumentedHardware{Hardware: hw, lockID: lockID}
+}
+
+func (hw *instrumentedHardware) SetStatus(status lock.LockStatus) error {
+	start := time.Now()
+	err := hw.Hardware.SetStatus(status)
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err != nil {
+		hardwareErrors.WithLabelValues(hw.lockID, hardwareErrorKind(err)).Inc()
+		hw.lastErr, hw.lastErrTime = err, time.Now()
+		return err
+	}
+	actuationLatency.WithLabelValues(hw.lockID, status.String()).Observe(time.Since(start).Seconds())
+	hw.actuations++
+	return nil
+}
+
+// stats returns the number of successful state changes, and the most recent
+// error (along with the time at which it occurred) encountered while
+// changing state.
+func (hw *instrumentedHardware) stats() (actuations uint64, lastErr error, lastErrTime time.Time) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	return hw.actuations, hw.lastErr, hw.lastErrTime
+}
+
+func hardwareErrorKind(err error) string {
+	if _, ok := err.(internal.StuckError); ok {
+		return "stuck"
+	}
+	return "other"
+}
+
+// recordRPC counts an invocation of method on the lock identified by lockID
+// (see lockInstance.id) by a caller with the provided category, given the
+// error it completed with.
+func recordRPC(lockID, method, category string, err error) {
+	outcome := outcomeOK
+	if err != nil {
+		outcome = outcomeError
+	}
+	rpcCounter.WithLabelValues(lockID, method, outcome, metricsCategory(category)).Inc()
+}
+
+// setMetricsCategories sets the key categories that label RPC metrics.
+func setMetricsCategories(categories []string) {
+	set := make(map[string]bool)
+	for _, c := range categories {
+		set[c] = true
+	}
+	metricsCategories.Lock()
+	defer metricsCategories.Unlock()
+	metricsCategories.set = set
+}
+
+// metricsCategory returns the label of RPC metrics for a caller with the
+// provided category (see callerCategory). Since the senders of keys choose
+// their categories freely, categories other than those set with
+// setMetricsCategories are labelled categoryOther, so that key holders cannot
+// create any number of metrics.
+func metricsCategory(category string) string {
+	if category == categoryOwner || category == categoryUnknown {
+		return category
+	}
+	metricsCategories.Lock()
+	defer metricsCategories.Unlock()
+	if metricsCategories.set[category] {
+		return category
+	}
+	return categoryOther
+}
+
+// callerCategory returns the category under which the holder of a key for
+// the lock 'lockName' was classified by the sender of the key (e.g.,
+// "friend" for the key <lockName>:key:friend), or categoryOwner if the caller
+// presented the key obtained by claiming the lock.
+func callerCategory(lockName string, remoteBlessingNames []string) string {
+	key := lockName + security.ChainSeparator + keyBlessingExtension
+	for _, b := range remoteBlessingNames {
+		if b == key {
+			return categoryOwner
+		}
+	}
+	for _, b := range remoteBlessingNames {
+		if strings.HasPrefix(b, key+security.ChainSeparator) {
+			return strings.SplitN(strings.TrimPrefix(b, key+security.ChainSeparator), security.ChainSeparator, 2)[0]
+		}
+	}
+	return categoryUnknown
+}
+
+// metricsAuthorizer is a security.Authorizer that counts the calls to the lock
+// identified by lockID, and claimed with the name lockName (empty if it is not
+// claimed), rejected by the underlying authorizer.
+type metricsAuthorizer struct {
+	security.Authorizer
+	lockID   string
+	lockName string
+}
+
+func (a metricsAuthorizer) Authorize(ctx *context.T, call security.Call) error {
+	err := a.Authorizer.Authorize(ctx, call)
+	if err != nil {
+		category := categoryUnknown
+		if len(a.lockName) > 0 {
+			remoteBlessingNames, _ := security.RemoteBlessingNames(ctx, call)
+			category = callerCategory(a.lockName, remoteBlessingNames)
+		}
+		rpcCounter.WithLabelValues(a.lockID, call.Method(), outcomeDenied, metricsCategory(category)).Inc()
+	}
+	return err
+}
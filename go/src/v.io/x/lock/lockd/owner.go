@@ -0,0 +1,54 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const ownerFileName = "owner.json"
+
+// owner identifies the principal that claimed a lock, as recorded in the
+// lock's configuration directory when it was claimed.
+type owner struct {
+	// Key is the public key of the principal.
+	Key string
+	// Blessings are the blessing names that the principal presented when
+	// claiming the lock, from which the name of its client in the local
+	// neighborhood is derived (see locklib.User).
+	Blessings []string
+}
+
+// loadOwner reads the owner recorded in dir. It returns false if no owner
+// has been recorded, e.g. for locks claimed by an older lockd.
+func loadOwner(dir string) (owner, bool, error) {
+	var o owner
+	data, err := ioutil.ReadFile(filepath.Join(dir, ownerFileName))
+	if os.IsNotExist(err) {
+		return o, false, nil
+	} else if err != nil {
+		return o, false, err
+	}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return o, false, err
+	}
+	return o, true, nil
+}
+
+func (o owner) save(dir string) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, ownerFileName)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+)
+
+const permsFileName = "perms.json"
+
+var (
+	errBadVersion    = errors.New("version mismatch")
+	errOwnerNotAdmin = errors.New("the owner must be granted Admin")
+)
+
+// permsStore holds the permissions of a lock, which authorize the methods of
+// Lock and LockAdmin according to their access tags, in a file in the lock's
+// configuration directory. It is a security.Authorizer that applies them.
+type permsStore struct {
+	path string
+	// owner is the blessing name with which the lock was claimed, which is
+	// always granted access.Admin.
+	owner string
+
+	mu      sync.Mutex
+	perms   access.Permissions // GUARDED_BY(mu)
+	version uint64             // GUARDED_BY(mu)
+}
+
+// savedPerms is the content of the permissions file.
+type savedPerms struct {
+	Perms   access.Permissions
+	Version uint64
+}
+
+// loadPermsStore loads the permissions of the lock claimed as lockName. A lock
+// that has none yet grants Read and Write to its key and all extensions of it,
+// and Admin to its key alone, as lockd did before permissions were added.
+func loadPermsStore(dir, lockName string) (*permsStore, error) {
+	key := lockName + security.ChainSeparator + keyBlessingExtension
+	s := &permsStore{path: filepath.Join(dir, permsFileName), owner: key}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.perms = access.Permissions{}.
+			Add(security.BlessingPattern(key), string(access.Read), string(access.Write)).
+			Add(security.BlessingPattern(key).MakeNonExtendable(), string(access.Admin))
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var saved savedPerms
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	s.perms, s.version = saved.Perms, saved.Version
+	return s, nil
+}
+
+// get returns the permissions and their version.
+func (s *permsStore) get() (access.Permissions, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.perms.Copy(), strconv.FormatUint(s.version, 10)
+}
+
+// set replaces the permissions, unless version is set and differs from their
+// current version, in which case it returns errBadVersion. It returns
+// errOwnerNotAdmin if perms do not grant access.Admin to the owner of the
+// lock, so that the owner cannot lose control of it.
+func (s *permsStore) set(perms access.Permissions, version string) error {
+	if !perms[string(access.Admin)].Includes(s.owner) {
+		return errOwnerNotAdmin
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version != "" && version != strconv.FormatUint(s.version, 10) {
+		return errBadVersion
+	}
+	data, err := json.Marshal(savedPerms{Perms: perms, Version: s.version + 1})
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.perms = perms.Copy()
+	s.version++
+	return nil
+}
+
+func (s *permsStore) Authorize(ctx *context.T, call security.Call) error {
+	perms, _ := s.get()
+	auth, err := access.PermissionsAuthorizer(perms, access.TypicalTagType())
+	if err != nil {
+		return err
+	}
+	return auth.Authorize(ctx, call)
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+
+	"v.io/x/lock"
+	"v.io/x/ref/test"
+	"v.io/x/ref/test/testutil"
+)
+
+// testKeys returns the principal of a lock claimed as "door", along with the
+// blessings of its owner, of a guest to whom the owner sent a key, and of a
+// stranger with a key to another lock claimed as "door".
+func testKeys(t *testing.T) (lockP security.Principal, owner, guest, stranger security.Blessings) {
+	lockP = testutil.NewPrincipal()
+	lockB, err := lockP.BlessSelf("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := security.AddToRoots(lockP, lockB); err != nil {
+		t.Fatal(err)
+	}
+	ownerP, guestP, otherP := testutil.NewPrincipal(), testutil.NewPrincipal(), testutil.NewPrincipal()
+	if owner, err = lockP.Bless(ownerP.PublicKey(), lockB, keyBlessingExtension, security.UnconstrainedUse()); err != nil {
+		t.Fatal(err)
+	}
+	if guest, err = ownerP.Bless(guestP.PublicKey(), owner, "guest", security.UnconstrainedUse()); err != nil {
+		t.Fatal(err)
+	}
+	otherB, err := otherP.BlessSelf("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stranger, err = otherP.Bless(otherP.PublicKey(), otherB, keyBlessingExtension, security.UnconstrainedUse()); err != nil {
+		t.Fatal(err)
+	}
+	return lockP, owner, guest, stranger
+}
+
+func authorize(ctx *context.T, s *permsStore, lockP security.Principal, remote security.Blessings, method rpc.MethodDesc) error {
+	return s.Authorize(ctx, security.NewCall(&security.CallParams{
+		Method:          method.Name,
+		MethodTags:      method.Tags,
+		LocalPrincipal:  lockP,
+		RemoteBlessings: remote,
+	}))
+}
+
+func newTestPermsStore(t *testing.T) (*permsStore, func()) {
+	dir, err := ioutil.TempDir("", "lockd-perms-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadPermsStore(dir, "door")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestDefaultPerms(t *testing.T) {
+	ctx, shutdown := test.V23Init()
+	defer shutdown()
+	s, cleanup := newTestPermsStore(t)
+	defer cleanup()
+
+	perms, version := s.get()
+	want := access.Permissions{}.
+		Add("door:key", string(access.Read), string(access.Write)).
+		Add("door:key:$", string(access.Admin))
+	if !reflect.DeepEqual(perms, want) {
+		t.Errorf("got default permissions %v, want %v", perms, want)
+	}
+	if version != "0" {
+		t.Errorf("got version %q, want %q", version, "0")
+	}
+
+	lockP, owner, guest, stranger := testKeys(t)
+	for _, desc := range []rpc.InterfaceDesc{lock.LockDesc, lock.LockAdminDesc} {
+		for _, method := range desc.Methods {
+			if err := authorize(ctx, s, lockP, owner, method); err != nil {
+				t.Errorf("%v.%v: owner denied: %v", desc.Name, method.Name, err)
+			}
+			// Guests are granted Read and Write, but not Admin, which all
+			// the methods of LockAdmin, and Lock.Alarms, require.
+			err := authorize(ctx, s, lockP, guest, method)
+			if got, want := err == nil, desc.Name == lock.LockDesc.Name && method.Name != "Alarms"; got != want {
+				t.Errorf("%v.%v: guest authorized %v (error %v), want %v", desc.Name, method.Name, got, err, want)
+			}
+			if err := authorize(ctx, s, lockP, stranger, method); err == nil {
+				t.Errorf("%v.%v: stranger authorized", desc.Name, method.Name)
+			}
+		}
+	}
+}
+
+func TestSetPerms(t *testing.T) {
+	ctx, shutdown := test.V23Init()
+	defer shutdown()
+	s, cleanup := newTestPermsStore(t)
+	defer cleanup()
+	lockP, _, guest, _ := testKeys(t)
+
+	// The owner cannot be dropped from Admin.
+	noOwner := access.Permissions{}.
+		Add("door:key", string(access.Read), string(access.Write), string(access.Admin)).
+		Blacklist("door:key", string(access.Admin))
+	if err := s.set(noOwner, ""); err != errOwnerNotAdmin {
+		t.Errorf("got error %v when dropping the owner from Admin, want %v", err, errOwnerNotAdmin)
+	}
+	if err := s.set(access.Permissions{}.Add("door:key:guest", string(access.Write)), ""); err != errOwnerNotAdmin {
+		t.Errorf("got error %v when granting no Admin, want %v", err, errOwnerNotAdmin)
+	}
+
+	// Guests can be granted Admin, but only for the current version of the
+	// permissions.
+	perms, version := s.get()
+	perms.Add("door:key:guest", string(access.Admin))
+	if err := s.set(perms, "1"); err != errBadVersion {
+		t.Errorf("got error %v with a stale version, want %v", err, errBadVersion)
+	}
+	if err := s.set(perms, version); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorize(ctx, s, lockP, guest, lock.LockAdminDesc.Methods[0]); err != nil {
+		t.Errorf("guest granted Admin denied: %v", err)
+	}
+
+	// The permissions are persisted.
+	reloaded, err := loadPermsStore(filepath.Dir(s.path), "door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.get(); !reflect.DeepEqual(got, perms) {
+		t.Errorf("got permissions %v after reloading, want %v", got, perms)
+	}
+	if _, version := reloaded.get(); version != "1" {
+		t.Errorf("got version %q after reloading, want %q", version, "1")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"v.io/x/lock"
+)
+
+const pinsFileName = "pins.json"
+
+var (
+	pinRE = regexp.MustCompile(`^[0-9]{4,12}$`)
+
+	errPINExists   = errors.New("PIN exists")
+	errPINNotFound = errors.New("PIN not found")
+)
+
+// storedPIN is a PIN as stored by pinStore. Only a salted hash of the PIN
+// itself is stored.
+type storedPIN struct {
+	lock.PINInfo
+	Salt []byte
+	Hash []byte
+}
+
+// pinStore holds the PINs of a lock, in a file in the lock's configuration
+// directory.
+type pinStore struct {
+	path string
+
+	mu   sync.Mutex
+	pins []storedPIN // GUARDED_BY(mu)
+}
+
+func loadPINStore(dir string) (*pinStore, error) {
+	s := &pinStore{path: filepath.Join(dir, pinsFileName)}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.pins); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add adds pin, described by info, to the store. It returns errPINExists if
+// the store already has a PIN with the label info.Label.
+func (s *pinStore) add(pin string, info lock.PINInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pins {
+		if p.Label == info.Label {
+			return errPINExists
+		}
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	s.pins = append(s.pins, storedPIN{PINInfo: info, Salt: salt, Hash: hashPIN(salt, pin)})
+	if err := s.saveLocked(); err != nil {
+		s.pins = s.pins[:len(s.pins)-1]
+		return err
+	}
+	return nil
+}
+
+// remove removes the PIN with the provided label from the store, or returns
+// errPINNotFound if there is none.
+func (s *pinStore) remove(label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.pins {
+		if p.Label != label {
+			continue
+		}
+		orig := s.pins
+		s.pins = append(append([]storedPIN(nil), s.pins[:i]...), s.pins[i+1:]...)
+		if err := s.saveLocked(); err != nil {
+			s.pins = orig
+			return err
+		}
+		return nil
+	}
+	return errPINNotFound
+}
+
+func (s *pinStore) list() []lock.PINInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]lock.PINInfo, len(s.pins))
+	for i, p := range s.pins {
+		ret[i] = p.PINInfo
+	}
+	return ret
+}
+
+// match returns the label of the PIN in the store that is equal to pin and
+// valid at time now, if any.
+func (s *pinStore) match(pin string, now time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pins {
+		if subtle.ConstantTimeCompare(p.Hash, hashPIN(p.Salt, pin)) != 1 {
+			continue
+		}
+		if (!p.NotBefore.IsZero() && now.Before(p.NotBefore)) || (!p.NotAfter.IsZero() && now.After(p.NotAfter)) {
+			continue
+		}
+		return p.Label, true
+	}
+	return "", false
+}
+
+// REQUIRES: s.mu is held.
+func (s *pinStore) saveLocked() error {
+	data, err := json.Marshal(s.pins)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func hashPIN(salt []byte, pin string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(pin))
+	return h.Sum(nil)
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"v.io/v23/context"
+
+	"v.io/x/lib/vlog"
+)
+
+// lowBatteryError is returned when the lock refuses to change state because
+// the level of its battery is below PowerConfig.MinLevel.
+type lowBatteryError struct {
+	level, min float64
+}
+
+func (e lowBatteryError) Error() string {
+	return fmt.Sprintf("battery level %d%% is below the %d%% required to operate the lock", percent(e.level), percent(e.min))
+}
+
+// rpcError converts errors returned by lockInstance.setStatus to the errors
+// returned to RPC callers.
+func rpcError(ctx *context.T, err error) error {
+	if e, ok := err.(lowBatteryError); ok {
+		return NewErrLowBattery(ctx, percent(e.level), percent(e.min))
+	}
+	return err
+}
+
+func percent(level float64) int32 {
+	return int32(level*100 + 0.5)
+}
+
+// checkBattery returns a lowBatteryError if the lock is configured to refuse
+// to change state when its battery is low, and it is. Failures to read the
+// level of the battery are logged, but do not prevent the lock from changing
+// state.
+func (l *lockInstance) checkBattery() error {
+	if l.power == nil || l.powerConfig.MinLevel <= 0 {
+		return nil
+	}
+	level, err := l.power.BatteryLevel()
+	if err != nil {
+		vlog.Errorf("Failed to read the battery level of lock %q: %v", l.id, err)
+		return nil
+	}
+	if level < l.powerConfig.MinLevel {
+		return lowBatteryError{level: level, min: l.powerConfig.MinLevel}
+	}
+	return nil
+}
+
+// monitorBattery checks the level of the battery of the lock every
+// PowerConfig.CheckInterval, forever, and warns when it falls below
+// PowerConfig.LowLevel.
+func (l *lockInstance) monitorBattery() {
+	low := false
+	for ; ; time.Sleep(l.powerConfig.CheckInterval.Duration) {
+		level, err := l.power.BatteryLevel()
+		if err != nil {
+			vlog.Errorf("Failed to read the battery level of lock %q: %v", l.id, err)
+			continue
+		}
+		switch {
+		case level < l.powerConfig.LowLevel && !low:
+			vlog.Errorf("The battery of lock %q is low (%d%%) and must be replaced", l.id, percent(level))
+			l.audit.record(auditEvent{Event: auditLowBattery, Battery: percent(level)})
+		case level >= l.powerConfig.LowLevel && low:
+			vlog.Infof("The battery of lock %q is no longer low (%d%%)", l.id, percent(level))
+		}
+		low = level < l.powerConfig.LowLevel
+	}
+}
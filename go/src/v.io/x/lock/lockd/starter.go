@@ -12,43 +12,52 @@ import (
 	"v.io/v23/context"
 	"v.io/v23/naming"
 	"v.io/v23/security"
+	"v.io/v23/verror"
 	"v.io/x/lib/vlog"
 	"v.io/x/lock/locklib"
 )
 
-var unclaimedLockNhSuffix = "unclaimed-lock-" + fmt.Sprintf("%d", rand.Intn(1000000))
+// unclaimedLockNhSuffix returns the name in the local neighborhood of the
+// unclaimed lock l (without locklib.LockNhPrefix), which includes its
+// lockInstance.id, if any, to help tell the locks managed by a lockd apart.
+func unclaimedLockNhSuffix(l *lockInstance) string {
+	if len(l.id) == 0 {
+		return "unclaimed-lock-" + fmt.Sprintf("%d", rand.Intn(1000000))
+	}
+	return "unclaimed-lock-" + l.id + "-" + fmt.Sprintf("%d", rand.Intn(1000000))
+}
 
 // startServer checks whether the lock has been claimed and then appropriately
 // starts the server.
 //
 // Returns the callback to be invoked to shutdown the server on success, or
 // an error on failure
-func startServer(ctx *context.T, configDir string) (func(), error) {
+func startServer(ctx *context.T, l *lockInstance) (func(), error) {
 	// The lock is claimed if and only if there exists a file in the
 	// config directory from a previous claim.
-	if isLockClaimed(configDir) {
-		return startLockServer(ctx, configDir)
+	if isLockClaimed(l.configDir) {
+		return startLockServer(ctx, l)
 	}
 
-	claimed, stopUnclaimedLock, err := startUnclaimedLockServer(ctx, configDir)
+	claimed, stopUnclaimedLock, err := startUnclaimedLockServer(ctx, l)
 	if err != nil {
 		return nil, err
 	}
 
 	stop := make(chan struct{})
 	stopped := make(chan struct{})
-	go waitToBeClaimedAndStartLockServer(ctx, configDir, stopUnclaimedLock, claimed, stop, stopped)
+	go waitToBeClaimedAndStartLockServer(ctx, l, stopUnclaimedLock, claimed, stop, stopped)
 	return func() {
 		close(stop)
 		<-stopped
 	}, nil
 }
 
-func startUnclaimedLockServer(ctx *context.T, configDir string) (<-chan struct{}, func(), error) {
+func startUnclaimedLockServer(ctx *context.T, l *lockInstance) (<-chan struct{}, func(), error) {
 	// Start a local mounttable where the unclaimed lock server would
 	// be mounted, and make this mounttable visible in the local
 	// neighborhood.
-	mtName, stopMT, err := locklib.StartMounttable(ctx, configDir, locklib.LockNhPrefix+unclaimedLockNhSuffix)
+	mtName, stopMT, err := locklib.StartMounttable(ctx, l.configDir, locklib.LockNhPrefix+unclaimedLockNhSuffix(l))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -59,7 +68,7 @@ func startUnclaimedLockServer(ctx *context.T, configDir string) (<-chan struct{}
 	}
 	claimed := make(chan struct{})
 	ctx, cancel := context.WithCancel(ctx)
-	_, server, err := v23.WithNewServer(ctx, lockObjectName(ctx), newUnclaimedLock(claimed, configDir), security.AllowEveryone())
+	_, server, err := v23.WithNewServer(ctx, lockObjectName(ctx), newUnclaimedLock(claimed, l), metricsAuthorizer{lockoutAuthorizer{security.AllowEveryone(), l}, l.id, ""})
 	if err != nil {
 		stopMT()
 		return nil, nil, err
@@ -76,13 +85,14 @@ func startUnclaimedLockServer(ctx *context.T, configDir string) (<-chan struct{}
 	return claimed, stopUnclaimedLock, nil
 }
 
-func startLockServer(ctx *context.T, configDir string) (func(), error) {
+func startLockServer(ctx *context.T, l *lockInstance) (func(), error) {
 	blessings, _ := v23.GetPrincipal(ctx).BlessingStore().Default()
 	lockNhSuffix := fmt.Sprint(blessings)
+	nhName := locklib.LockNhPrefix + lockNhSuffix
 	// Start a local mounttable where the lock server would be
 	// mounted, and make this mounttable visible in the local
 	// neighborhood.
-	mtName, stopMT, err := locklib.StartMounttable(ctx, configDir, locklib.LockNhPrefix+lockNhSuffix)
+	mtName, stopMT, err := locklib.StartMounttable(ctx, l.configDir, nhName)
 	if err != nil {
 		return nil, err
 	}
@@ -91,8 +101,19 @@ func startLockServer(ctx *context.T, configDir string) (func(), error) {
 		stopMT()
 		return nil, err
 	}
+	perms, err := loadPermsStore(l.configDir, lockNhSuffix)
+	if err != nil {
+		stopMT()
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(ctx)
-	_, server, err := v23.WithNewServer(ctx, lockObjectName(ctx), newLock(), security.DefaultAuthorizer())
+	disp := &lockDispatcher{
+		lock:      newLock(l, lockNhSuffix),
+		lockAuth:  metricsAuthorizer{holdersAuthorizer{lockoutAuthorizer{depthAuthorizer{perms}, l}, l}, l.id, lockNhSuffix},
+		admin:     newLockAdmin(l, lockNhSuffix, nhName, perms),
+		adminAuth: metricsAuthorizer{depthAuthorizer{perms}, l.id, lockNhSuffix},
+	}
+	_, server, err := v23.WithNewDispatchingServer(ctx, lockObjectName(ctx), disp)
 	if err != nil {
 		stopMT()
 		return nil, err
@@ -109,7 +130,7 @@ func startLockServer(ctx *context.T, configDir string) (func(), error) {
 	return stopLock, nil
 }
 
-func waitToBeClaimedAndStartLockServer(ctx *context.T, configDir string, stopUnclaimedLock func(), claimed, stop <-chan struct{}, stopped chan<- struct{}) {
+func waitToBeClaimedAndStartLockServer(ctx *context.T, l *lockInstance, stopUnclaimedLock func(), claimed, stop <-chan struct{}, stopped chan<- struct{}) {
 	defer close(stopped)
 	select {
 	case <-claimed:
@@ -118,7 +139,7 @@ func waitToBeClaimedAndStartLockServer(ctx *context.T, configDir string, stopUnc
 		stopUnclaimedLock()
 		return
 	}
-	stopLock, err := startLockServer(ctx, configDir)
+	stopLock, err := startLockServer(ctx, l)
 	if err != nil {
 		vlog.Errorf("Failed to start lock server after it was claimed: %v", err)
 		return
@@ -127,6 +148,23 @@ func waitToBeClaimedAndStartLockServer(ctx *context.T, configDir string, stopUnc
 	<-stop // Wait to be stopped
 }
 
+// lockDispatcher serves the Lock interface at the lock's object name and the
+// LockAdmin interface at locklib.AdminSuffix under it.
+type lockDispatcher struct {
+	lock, admin         interface{}
+	lockAuth, adminAuth security.Authorizer
+}
+
+func (d *lockDispatcher) Lookup(ctx *context.T, suffix string) (interface{}, security.Authorizer, error) {
+	switch suffix {
+	case "":
+		return d.lock, d.lockAuth, nil
+	case locklib.AdminSuffix:
+		return d.admin, d.adminAuth, nil
+	}
+	return nil, nil, verror.New(verror.ErrNoExist, ctx, suffix)
+}
+
 func lockObjectName(ctx *context.T) string {
 	nsroots := v23.GetNamespace(ctx).Roots()
 	if len(nsroots) == 0 {
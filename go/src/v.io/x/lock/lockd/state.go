@@ -0,0 +1,122 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"v.io/x/lib/vlog"
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+const stateFileName = "state.json"
+
+// lockState is the state of a lock as last known to lockd, which is saved in
+// the lock's configuration directory so that it survives restarts.
+type lockState struct {
+	// Commanded is the state that lockd last commanded the lock to.
+	Commanded lock.LockStatus
+	// Observed is the state in which lockd last observed the lock, whatever
+	// caused it.
+	Observed lock.LockStatus
+	// Pending is true while the lock is being commanded to Commanded. It is
+	// saved before the lock is commanded, so that commands interrupted by a
+	// crash are known.
+	Pending bool
+}
+
+// loadLockState reads the state saved in dir. It returns false if no state
+// has been saved.
+func loadLockState(dir string) (lockState, bool, error) {
+	var s lockState
+	data, err := ioutil.ReadFile(filepath.Join(dir, stateFileName))
+	if os.IsNotExist(err) {
+		return s, false, nil
+	} else if err != nil {
+		return s, false, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, false, err
+	}
+	return s, true, nil
+}
+
+func (s lockState) save(dir string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, stateFileName)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// saveStateLocked saves the state of the lock, logging failures.
+//
+// REQUIRES: l.actuating is held.
+func (l *lockInstance) saveStateLocked() {
+	if err := l.state.save(l.configDir); err != nil {
+		vlog.Errorf("Failed to save the state of lock %q: %v", l.id, err)
+	}
+}
+
+// reconcile compares the state of the lock, as sensed by its hardware, with
+// the state saved before lockd last stopped: the commanded state if a command
+// was interrupted, and the observed state otherwise. If they differ, e.g.
+// because the lock was operated by hand while the device was off or because
+// the command did not complete, it either raises an alarm or restores the
+// saved state, according to policy (see HardwareConfig.StartupPolicy).
+//
+// Hardware that locks by itself is not reconciled, as it does not keep its
+// state across restarts.
+func (l *lockInstance) reconcile(policy string) {
+	saved, ok, err := loadLockState(l.configDir)
+	if err != nil {
+		vlog.Errorf("Failed to load the state of lock %q, not reconciling it: %v", l.id, err)
+	}
+	l.actuating.Lock()
+	// Hardware that cannot sense the lock reports the state it was last
+	// observed in, since it has not moved it since.
+	if u, isUnsensed := l.rawHW.(internal.Unsensed); ok && isUnsensed && u.AssumeStatus(saved.Observed) {
+		l.status = l.hw.Status()
+	}
+	sensed := l.status
+	want := saved.Observed
+	if saved.Pending {
+		want = saved.Commanded
+	}
+	mismatch := ok && !l.hw.Info().Relocks && sensed != want
+	l.state = lockState{Commanded: sensed, Observed: sensed}
+	if ok {
+		l.state.Commanded = saved.Commanded
+	}
+	l.saveStateLocked()
+	l.actuating.Unlock()
+	if !mismatch {
+		return
+	}
+
+	if saved.Pending {
+		vlog.Errorf("Lock %q is %v, but was being commanded to be %v when lockd stopped", l.id, sensed, want)
+	} else {
+		vlog.Errorf("Lock %q is %v, but was last observed %v", l.id, sensed, want)
+	}
+	if policy != "restore" {
+		l.raiseAlarm(lock.AlarmKindStateMismatch)
+		return
+	}
+	err = l.setStatus(want, lock.LockEvent{Cause: lock.LockEventCauseRestore})
+	if err != nil {
+		vlog.Errorf("Failed to restore lock %q to %v: %v", l.id, want, err)
+	}
+	l.audit.record(auditEvent{Event: auditRestore, Error: errorString(err)})
+}
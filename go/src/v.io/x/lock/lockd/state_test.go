@@ -0,0 +1,177 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+// scenarioConfig returns the configuration of hardware that replays s, which
+// is saved in dir.
+func scenarioConfig(t *testing.T, dir string, s internal.Scenario) internal.HardwareConfig {
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := internal.DefaultConfig().Hardware
+	cfg.Backend = "scenario"
+	cfg.ScenarioFile = filepath.Join(dir, "scenario.json")
+	cfg.ToggleWait = internal.Duration{Duration: 500 * time.Millisecond}
+	cfg.PollInterval = internal.Duration{Duration: 5 * time.Millisecond}
+	if err := ioutil.WriteFile(cfg.ScenarioFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestReconcile(t *testing.T) {
+	// The lock is sensed unlocked when lockd starts, and locks shortly after
+	// the relay is first energised, unless it is stuck.
+	locks := internal.Scenario{
+		Unlocked: true,
+		Actuations: []internal.ScenarioActuation{{Transitions: []internal.ScenarioTransition{
+			{At: internal.Duration{Duration: 10 * time.Millisecond}, Unlocked: false},
+		}}},
+	}
+	stuck := internal.Scenario{Unlocked: true}
+	// interrupted is the state saved when lockd crashes while locking the
+	// lock, between the two saves of setStatus.
+	interrupted := &lockState{Commanded: lock.Locked, Observed: lock.Unlocked, Pending: true}
+	tests := []struct {
+		name     string
+		scenario internal.Scenario
+		policy   string
+		saved    *lockState // nil if no state was saved
+		// want is the state of the lock, and of state.json, once
+		// reconciled.
+		want      lockState
+		wantAlarm bool
+		// wantRestore is the error of the restore event expected in the
+		// audit log, or "-" if no restore is expected.
+		wantRestore string
+	}{
+		{
+			name:        "no saved state",
+			scenario:    locks,
+			policy:      "restore",
+			want:        lockState{Commanded: lock.Unlocked, Observed: lock.Unlocked},
+			wantRestore: "-",
+		},
+		{
+			name:        "observed as sensed",
+			scenario:    locks,
+			policy:      "alert",
+			saved:       &lockState{Commanded: lock.Locked, Observed: lock.Unlocked},
+			want:        lockState{Commanded: lock.Locked, Observed: lock.Unlocked},
+			wantRestore: "-",
+		},
+		{
+			name:        "operated by hand, alert",
+			scenario:    locks,
+			policy:      "alert",
+			saved:       &lockState{Commanded: lock.Locked, Observed: lock.Locked},
+			want:        lockState{Commanded: lock.Locked, Observed: lock.Unlocked},
+			wantAlarm:   true,
+			wantRestore: "-",
+		},
+		{
+			name:     "operated by hand, restore",
+			scenario: locks,
+			policy:   "restore",
+			saved:    &lockState{Commanded: lock.Locked, Observed: lock.Locked},
+			want:     lockState{Commanded: lock.Locked, Observed: lock.Locked},
+		},
+		{
+			// The command completed, but lockd crashed before saving
+			// the observed state.
+			name:        "completed command",
+			scenario:    locks,
+			policy:      "alert",
+			saved:       &lockState{Commanded: lock.Unlocked, Observed: lock.Locked, Pending: true},
+			want:        lockState{Commanded: lock.Unlocked, Observed: lock.Unlocked},
+			wantRestore: "-",
+		},
+		{
+			name:        "interrupted command, alert",
+			scenario:    locks,
+			policy:      "alert",
+			saved:       interrupted,
+			want:        lockState{Commanded: lock.Locked, Observed: lock.Unlocked},
+			wantAlarm:   true,
+			wantRestore: "-",
+		},
+		{
+			name:     "interrupted command, restore",
+			scenario: locks,
+			policy:   "restore",
+			saved:    interrupted,
+			want:     lockState{Commanded: lock.Locked, Observed: lock.Locked},
+		},
+		{
+			name:        "interrupted command, restore fails",
+			scenario:    stuck,
+			policy:      "restore",
+			saved:       interrupted,
+			want:        lockState{Commanded: lock.Locked, Observed: lock.Unlocked},
+			wantRestore: "might be stuck",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lockd-state-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			cfg := scenarioConfig(t, dir, test.scenario)
+			cfg.StartupPolicy = test.policy
+			if test.saved != nil {
+				if err := test.saved.save(dir); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			l, err := newLockInstance("", dir, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.audit.f.Close()
+			if got := l.hw.Status(); got != test.want.Observed {
+				t.Errorf("got status %v, want %v", got, test.want.Observed)
+			}
+			saved, ok, err := loadLockState(dir)
+			if err != nil || !ok {
+				t.Fatalf("got (%v, %v) loading the saved state", ok, err)
+			}
+			if saved != test.want {
+				t.Errorf("got saved state %+v, want %+v", saved, test.want)
+			}
+			alarms := l.alarms.list()
+			if got := len(alarms) == 1 && alarms[0].Kind == lock.AlarmKindStateMismatch; got != test.wantAlarm || len(alarms) > 1 {
+				t.Errorf("got alarms %v, want a state mismatch alarm %v", alarms, test.wantAlarm)
+			}
+			audit, err := ioutil.ReadFile(filepath.Join(dir, auditLogFileName))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			restored := strings.Contains(string(audit), `"Event":"restore"`)
+			if wantRestored := test.wantRestore != "-"; restored != wantRestored {
+				t.Errorf("got restore in the audit log %v, want %v:\n%s", restored, wantRestored, audit)
+			}
+			if failed := strings.Contains(string(audit), `"Error":`); restored && (failed != (test.wantRestore != "") || !strings.Contains(string(audit), test.wantRestore)) {
+				t.Errorf("got audit log\n%s\nwant a restore with error %q", audit, test.wantRestore)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"v.io/v23/security"
+
+	"v.io/x/lock"
+	"v.io/x/lock/lockd/internal"
+)
+
+// unlockRequests enforces the two-person rule (see internal.TwoPersonConfig)
+// on the calls to Unlock.
+type unlockRequests struct {
+	now func() time.Time // time.Now, except in tests
+
+	mu      sync.Mutex
+	cfg     internal.TwoPersonConfig // GUARDED_BY(mu)
+	key     string                   // GUARDED_BY(mu), of the caller that requested the pending unlock
+	pending lock.PendingUnlock       // GUARDED_BY(mu), zero if there is none
+}
+
+func newUnlockRequests(cfg internal.TwoPersonConfig) *unlockRequests {
+	return &unlockRequests{now: time.Now, cfg: cfg}
+}
+
+func (r *unlockRequests) setConfig(cfg internal.TwoPersonConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	if !cfg.Enabled {
+		r.clearLocked()
+	}
+}
+
+// get returns the pending unlock, if any.
+func (r *unlockRequests) get() (lock.PendingUnlock, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked()
+	return r.pending, !r.pending.VDLIsZero()
+}
+
+// cancel discards the pending unlock, if any.
+func (r *unlockRequests) cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clearLocked()
+}
+
+// unlock is invoked when the caller with the provided key and blessing names
+// calls Unlock. If the two-person rule does not apply, it returns true. If
+// the caller confirms an unlock requested by another caller, it returns true
+// along with the blessing names of the latter. Otherwise, the call becomes
+// the pending unlock, and it returns false along with the time for which it
+// is pending.
+//
+// A caller cannot confirm an unlock requested with the same key, or with
+// blessing names related to its own (see relatedNames): keys can be
+// delegated, so the holder of <lock>:key:guest could otherwise confirm its
+// own unlock with a principal it blessed as <lock>:key:guest:x.
+func (r *unlockRequests) unlock(key string, blessings []string) (requester []string, window time.Duration, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cfg.Enabled {
+		return nil, 0, true
+	}
+	r.expireLocked()
+	if !r.pending.VDLIsZero() && key != r.key && !relatedNames(blessings, r.pending.Blessings) {
+		requester = r.pending.Blessings
+		r.clearLocked()
+		return requester, 0, true
+	}
+	now := r.now()
+	r.key = key
+	r.pending = lock.PendingUnlock{Blessings: blessings, Time: now, Expires: now.Add(r.cfg.Window.Duration)}
+	return nil, r.cfg.Window.Duration, false
+}
+
+// REQUIRES: r.mu is held.
+func (r *unlockRequests) expireLocked() {
+	if !r.pending.VDLIsZero() && !r.now().Before(r.pending.Expires) {
+		r.clearLocked()
+	}
+}
+
+// REQUIRES: r.mu is held.
+func (r *unlockRequests) clearLocked() {
+	r.key, r.pending = "", lock.PendingUnlock{}
+}
+
+// relatedNames returns true if a blessing name in a is equal to, or an
+// extension of, a blessing name in b, or vice versa.
+func relatedNames(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if extends(x, y) || extends(y, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extends returns true if name is equal to, or an extension of, n.
+func extends(name, n string) bool {
+	return name == n || strings.HasPrefix(name, n+security.ChainSeparator)
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"v.io/x/lock/lockd/internal"
+)
+
+func TestTwoPersonRule(t *testing.T) {
+	type call struct {
+		key       string
+		blessings []string
+		advance   time.Duration // before the call
+	}
+	guest := call{key: "k1", blessings: []string{"door:key:guest"}}
+	tests := []struct {
+		name  string
+		calls []call
+		// confirmed is whether the last call unlocks the lock.
+		confirmed bool
+	}{
+		{
+			name:      "distinct",
+			calls:     []call{guest, {key: "k2", blessings: []string{"door:key:friend"}}},
+			confirmed: true,
+		},
+		{
+			name:  "same key",
+			calls: []call{guest, {key: "k1", blessings: []string{"door:key:friend"}}},
+		},
+		{
+			name:  "same name",
+			calls: []call{guest, {key: "k2", blessings: []string{"door:key:friend", "door:key:guest"}}},
+		},
+		{
+			name:  "delegated by the requester",
+			calls: []call{guest, {key: "k2", blessings: []string{"door:key:guest:x"}}},
+		},
+		{
+			name:  "delegated by the confirmer",
+			calls: []call{{key: "k2", blessings: []string{"door:key:guest:x"}}, guest},
+		},
+		{
+			name:  "owner",
+			calls: []call{{key: "k2", blessings: []string{"door:key"}}, guest},
+		},
+		{
+			name:      "name sharing a prefix",
+			calls:     []call{guest, {key: "k2", blessings: []string{"door:key:guests"}}},
+			confirmed: true,
+		},
+		{
+			name:  "expired window",
+			calls: []call{guest, {key: "k2", blessings: []string{"door:key:friend"}, advance: time.Minute}},
+		},
+		{
+			name:      "within window",
+			calls:     []call{guest, {key: "k2", blessings: []string{"door:key:friend"}, advance: time.Minute - time.Second}},
+			confirmed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Unix(1e9, 0)
+			r := newUnlockRequests(internal.TwoPersonConfig{Enabled: true, Window: internal.Duration{Duration: time.Minute}})
+			r.now = func() time.Time { return now }
+			for i, c := range test.calls {
+				now = now.Add(c.advance)
+				requester, window, ok := r.unlock(c.key, c.blessings)
+				if i < len(test.calls)-1 {
+					if ok || window != time.Minute {
+						t.Fatalf("call %d: got (%v, %v), want the unlock to be pending for %v", i, window, ok, time.Minute)
+					}
+					continue
+				}
+				if ok != test.confirmed {
+					t.Fatalf("call %d: got confirmed %v, want %v", i, ok, test.confirmed)
+				}
+				if !ok {
+					// The call becomes the pending unlock instead.
+					if pending, _ := r.get(); !reflect.DeepEqual(pending.Blessings, c.blessings) {
+						t.Errorf("got pending unlock by %v, want %v", pending.Blessings, c.blessings)
+					}
+					continue
+				}
+				if want := test.calls[i-1].blessings; !reflect.DeepEqual(requester, want) {
+					t.Errorf("got requester %v, want %v", requester, want)
+				}
+				if _, pending := r.get(); pending {
+					t.Errorf("unlock is still pending after it was confirmed")
+				}
+			}
+		})
+	}
+}
+
+func TestTwoPersonRuleDisabled(t *testing.T) {
+	r := newUnlockRequests(internal.TwoPersonConfig{})
+	if _, _, ok := r.unlock("k1", []string{"door:key:guest"}); !ok {
+		t.Errorf("unlock is pending, but the two-person rule is disabled")
+	}
+}
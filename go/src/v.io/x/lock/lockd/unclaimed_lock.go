@@ -26,6 +26,8 @@ const (
 )
 
 type unclaimedLock struct {
+	l         *lockInstance // to record failed claims
+	id        string        // See lockInstance.id.
 	configDir string
 	claimed   chan<- struct{} // GUARDED_BY(mu)
 
@@ -33,8 +35,14 @@ type unclaimedLock struct {
 	mu sync.Mutex
 }
 
-func (ul *unclaimedLock) Claim(ctx *context.T, call rpc.ServerCall, name string) (security.Blessings, error) {
+func (ul *unclaimedLock) Claim(ctx *context.T, call rpc.ServerCall, name string) (_ security.Blessings, err error) {
 	vlog.Infof("Claim called by %q", call.Security().RemoteBlessings())
+	defer func() {
+		recordRPC(ul.id, "Claim", categoryUnknown, err)
+		if err != nil {
+			ul.l.recordFailure(remoteKey(call.Security()), presentedBlessingNames(ctx, call.Security()))
+		}
+	}()
 	if strings.ContainsAny(name, security.ChainSeparator) {
 		// TODO(ataly, ashankar): We have to error out in this case because of the current
 		// neighborhood setup wherein the neighborhood-name of a claimed lock's mounttable is
@@ -69,6 +77,12 @@ func (ul *unclaimedLock) Claim(ctx *context.T, call rpc.ServerCall, name string)
 		return security.Blessings{}, verror.Convert(verror.ErrInternal, ctx, err)
 	}
 
+	o := owner{Key: remoteKey(call.Security()), Blessings: presentedBlessingNames(ctx, call.Security())}
+	if err := o.save(ul.configDir); err != nil {
+		restore()
+		return security.Blessings{}, verror.Convert(verror.ErrInternal, ctx, err)
+	}
+
 	// Create a file in the config directory to indicate that lock has been claimed.
 	f, err := os.Create(filepath.Join(ul.configDir, claimFileName))
 	if err != nil {
@@ -121,6 +135,6 @@ func isLockClaimed(configDir string) bool {
 	return false
 }
 
-func newUnclaimedLock(claimed chan<- struct{}, configDir string) lock.UnclaimedLockServerStub {
-	return lock.UnclaimedLockServer(&unclaimedLock{configDir: configDir, claimed: claimed})
+func newUnclaimedLock(claimed chan<- struct{}, l *lockInstance) lock.UnclaimedLockServerStub {
+	return lock.UnclaimedLockServer(&unclaimedLock{l: l, id: l.id, configDir: l.configDir, claimed: claimed})
 }
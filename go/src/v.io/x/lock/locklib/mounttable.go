@@ -26,10 +26,22 @@ const (
 	// LockSuffix is the name under which a lock server is mounted in its
 	// mounttable.
 	LockSuffix = "lock"
+	// AdminSuffix is the name, relative to a lock server, under which
+	// the lock's administrative interface is served.
+	AdminSuffix = "admin"
 	// LockNeighborhoodPrefix is a prefix of the name in the local
 	// neighborhood on which a lock server's mounttable is made
 	// visible.
 	LockNhPrefix = "lock-"
+	// UserNhPrefix is a prefix of the name in the local neighborhood on
+	// which the mounttable of a user of locks is made visible, followed by
+	// User(<blessing names of the user>).
+	UserNhPrefix = "user-"
+	// AgentSuffix is the name, relative to the mounttable of a user of
+	// locks, under which the agent of the user is served (see "lock
+	// agent"). Among other things, the owner of a lock approves the
+	// unlocks that require it through its agent.
+	AgentSuffix = "agent"
 )
 
 // StartMounttable starts a local mounttable server with an authorization
@@ -0,0 +1,39 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locklib
+
+import (
+	"strings"
+
+	"v.io/v23/security"
+)
+
+const vanadiumBlessingPrefix = "dev.v.io:u"
+
+// User returns a comma-separated string of user identities obtained
+// from the provided blessing names.
+//
+// For each blessing name, User checks if it matches the pattern
+// 'vanadiumBlessingPrefix' and if so constructs the user identity by
+// stripping off 'vanadiumBlessingPrefix' from the blessing name.
+// Otherwise the user identity is simply the blessing name.
+//
+// In all case, the user identity is converted into a valid neighborhood-name
+// by replacing slahes with "@@".
+// TODO(ataly): Try to use conventions.GetClientUserIds instead.
+func User(bNames ...string) string {
+	nhFriendly := func(b string) string {
+		return strings.Replace(b, security.ChainSeparator, "@@", -1)
+	}
+	users := make([]string, len(bNames))
+	for i, b := range bNames {
+		if !security.BlessingPattern(vanadiumBlessingPrefix).MatchedBy(b) {
+			users[i] = nhFriendly(b)
+			continue
+		}
+		users[i] = nhFriendly(strings.TrimPrefix(b, vanadiumBlessingPrefix+security.ChainSeparator))
+	}
+	return strings.Join(users, ",")
+}